@@ -0,0 +1,622 @@
+package ipcalc
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+type Action uint8
+
+const (
+	ActionAccept Action = iota
+	ActionDrop
+	ActionReject
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAccept:
+		return "accept"
+	case ActionDrop:
+		return "drop"
+	case ActionReject:
+		return "reject"
+	}
+
+	return fmt.Sprintf("action(%d)", uint8(a))
+}
+
+type Protocol uint8
+
+const (
+	ProtocolICMP   Protocol = 1
+	ProtocolTCP    Protocol = 6
+	ProtocolUDP    Protocol = 17
+	ProtocolICMPv6 Protocol = 58
+	ProtocolSCTP   Protocol = 132
+	ProtocolAny    Protocol = 255 // reserved by IANA, so it is free to mean "any"
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolICMP:
+		return "icmp"
+	case ProtocolTCP:
+		return "tcp"
+	case ProtocolUDP:
+		return "udp"
+	case ProtocolICMPv6:
+		return "icmpv6"
+	case ProtocolSCTP:
+		return "sctp"
+	case ProtocolAny:
+		return "any"
+	}
+
+	return fmt.Sprintf("%d", uint8(p))
+}
+
+type PortRange struct {
+	First, Last uint16
+}
+
+func (p *PortRange) String() string {
+	if p == nil {
+		return "any"
+	}
+
+	if p.First == p.Last {
+		return fmt.Sprintf("%d", p.First)
+	}
+
+	return fmt.Sprintf("%d-%d", p.First, p.Last)
+}
+
+// Rule is one entry of an ACL. nil Src, Dst, SrcPorts and DstPorts match
+// everything.
+type Rule struct {
+	Name     string
+	Src      *Subnet
+	Dst      *Subnet
+	Protocol Protocol
+	SrcPorts *PortRange
+	DstPorts *PortRange
+	Action   Action
+
+	// rejectWith is the --reject-with option and counters the
+	// "[packets:bytes]" counters of an imported iptables rule, they are
+	// written back unchanged.
+	rejectWith string
+	counters   string
+}
+
+func subnetOrAny(s *Subnet) string {
+	if s == nil {
+		return "any"
+	}
+
+	return s.GetCidr()
+}
+
+func cloneSubnet(s *Subnet) *Subnet {
+	if s == nil {
+		return nil
+	}
+
+	return s.CloneBase()
+}
+
+func clonePorts(p *PortRange) *PortRange {
+	if p == nil {
+		return nil
+	}
+
+	res := *p
+	return &res
+}
+
+// clone returns a deep copy of the rule, so changing the copy or its
+// subnets and port ranges leaves r unchanged.
+func (r *Rule) clone() *Rule {
+	res := *r
+	res.Src = cloneSubnet(r.Src)
+	res.Dst = cloneSubnet(r.Dst)
+	res.SrcPorts = clonePorts(r.SrcPorts)
+	res.DstPorts = clonePorts(r.DstPorts)
+
+	return &res
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("%s %s %s:%s -> %s:%s", r.Action, r.Protocol,
+		subnetOrAny(r.Src), r.SrcPorts, subnetOrAny(r.Dst), r.DstPorts)
+}
+
+type Packet struct {
+	Src      net.IP
+	Dst      net.IP
+	Protocol Protocol
+	SrcPort  uint16
+	DstPort  uint16
+}
+
+// OpaqueRule is a rule of an imported chain the ACL can not express, like an
+// interface or conntrack match, a negated match or a jump to another chain.
+// It is kept as Text and written back unchanged before the ACL rule at Index.
+type OpaqueRule struct {
+	Index int
+	Text  string
+}
+
+// ACL is an ordered list of rules, the first matching rule wins. Rules are
+// indexed by their source prefix in a Table, so evaluation only has to check
+// the rules on the path of the packet source. The rules are kept as copies
+// and changed only through the methods, which drop the index. Rules and
+// Evaluate return copies as well.
+//
+// Opaque rules keep their place between the rules when rules are removed.
+// Evaluate does not see them, Analyze reports them.
+type ACL struct {
+	Default Action
+
+	rules  []*Rule
+	opaque []OpaqueRule
+	index  *Table
+	bySrc  map[*Subnet][]int
+	anySrc []int
+}
+
+func NewACL(def Action) *ACL {
+	return &ACL{Default: def}
+}
+
+func checkRule(r *Rule) error {
+	if r.Src != nil && r.Dst != nil && r.Src.isIPv6 != r.Dst.isIPv6 {
+		return fmt.Errorf("source and destination of a rule have to be the same ip version")
+	}
+
+	for _, ports := range []*PortRange{r.SrcPorts, r.DstPorts} {
+		if ports != nil && ports.First > ports.Last {
+			return fmt.Errorf("invalid port range %d-%d", ports.First, ports.Last)
+		}
+	}
+
+	return nil
+}
+
+// Add appends a copy of r to the rules.
+func (a *ACL) Add(r *Rule) error {
+	if err := checkRule(r); err != nil {
+		return err
+	}
+
+	a.rules = append(a.rules, r.clone())
+	a.index = nil
+
+	return nil
+}
+
+// Set replaces rule i with a copy of r.
+func (a *ACL) Set(i int, r *Rule) error {
+	if i < 0 || i >= len(a.rules) {
+		return fmt.Errorf("rule %d out of range", i)
+	}
+
+	if err := checkRule(r); err != nil {
+		return err
+	}
+
+	a.rules[i] = r.clone()
+	a.index = nil
+
+	return nil
+}
+
+// Remove deletes rule i, the later rules and opaque rules move up by one.
+func (a *ACL) Remove(i int) error {
+	if i < 0 || i >= len(a.rules) {
+		return fmt.Errorf("rule %d out of range", i)
+	}
+
+	a.rules = append(a.rules[:i], a.rules[i+1:]...)
+	for k := range a.opaque {
+		if a.opaque[k].Index > i {
+			a.opaque[k].Index--
+		}
+	}
+	a.index = nil
+
+	return nil
+}
+
+// AddOpaque appends an opaque rule, it comes before the rules added later.
+func (a *ACL) AddOpaque(text string) {
+	a.opaque = append(a.opaque, OpaqueRule{Index: len(a.rules), Text: text})
+}
+
+// Opaque returns the opaque rules in order.
+func (a *ACL) Opaque() []OpaqueRule {
+	return append([]OpaqueRule{}, a.opaque...)
+}
+
+// Rules returns copies of the rules in order.
+func (a *ACL) Rules() []*Rule {
+	res := make([]*Rule, 0, len(a.rules))
+	for _, r := range a.rules {
+		res = append(res, r.clone())
+	}
+
+	return res
+}
+
+func (a *ACL) Len() int {
+	return len(a.rules)
+}
+
+func (a *ACL) reindex() error {
+	if a.index != nil {
+		return nil
+	}
+
+	index := NewTable()
+	a.bySrc = map[*Subnet][]int{}
+	a.anySrc = nil
+
+	for i, r := range a.rules {
+		if r.Src == nil {
+			a.anySrc = append(a.anySrc, i)
+			continue
+		}
+
+		node, err := index.insertOrFind(r.Src)
+		if err != nil {
+			return err
+		}
+		a.bySrc[node] = append(a.bySrc[node], i)
+	}
+	a.index = index
+
+	return nil
+}
+
+// Evaluate returns a copy of the first rule matching the packet and its
+// index, or nil and -1 when the default action applies.
+func (a *ACL) Evaluate(p Packet) (*Rule, int) {
+	if err := a.reindex(); err != nil {
+		return nil, -1
+	}
+
+	candidates := append([]int{}, a.anySrc...)
+	if node, err := a.index.LookupIP(p.Src); err == nil {
+		for ; node != nil; node = node.parent {
+			candidates = append(candidates, a.bySrc[node]...)
+		}
+	}
+	sort.Ints(candidates)
+
+	src := newHostSubnet(p.Src)
+	dst := newHostSubnet(p.Dst)
+	for _, i := range candidates {
+		r := a.rules[i]
+		if subnetCovers(r.Src, src) && subnetCovers(r.Dst, dst) &&
+			(r.Protocol == ProtocolAny || r.Protocol == p.Protocol) &&
+			portsContain(r.SrcPorts, p.SrcPort) && portsContain(r.DstPorts, p.DstPort) {
+			return r.clone(), i
+		}
+	}
+
+	return nil, -1
+}
+
+// Action returns the action the ACL takes for the packet.
+func (a *ACL) Action(p Packet) Action {
+	r, _ := a.Evaluate(p)
+	if r == nil {
+		return a.Default
+	}
+
+	return r.Action
+}
+
+func subnetCovers(s, s2 *Subnet) bool {
+	if s == nil {
+		return true
+	}
+
+	return s.Covers(s2)
+}
+
+func subnetsIntersect(s, s2 *Subnet) bool {
+	if s == nil || s2 == nil {
+		return true
+	}
+
+	return s.isIPv6 == s2.isIPv6 && s.Intersect(s2)
+}
+
+func portsContain(p *PortRange, port uint16) bool {
+	return p == nil || (p.First <= port && port <= p.Last)
+}
+
+func portsCover(p, p2 *PortRange) bool {
+	if p == nil {
+		return true
+	}
+
+	return p2 != nil && p.First <= p2.First && p2.Last <= p.Last
+}
+
+func portsIntersect(p, p2 *PortRange) bool {
+	return p == nil || p2 == nil || (p.First <= p2.Last && p2.First <= p.Last)
+}
+
+// Covers reports whether every packet matched by r2 is matched by r.
+func (r *Rule) Covers(r2 *Rule) bool {
+	return subnetCovers(r.Src, r2.Src) && subnetCovers(r.Dst, r2.Dst) &&
+		(r.Protocol == ProtocolAny || r.Protocol == r2.Protocol) &&
+		portsCover(r.SrcPorts, r2.SrcPorts) && portsCover(r.DstPorts, r2.DstPorts)
+}
+
+// Intersects reports whether a packet can be matched by both rules.
+func (r *Rule) Intersects(r2 *Rule) bool {
+	return subnetsIntersect(r.Src, r2.Src) && subnetsIntersect(r.Dst, r2.Dst) &&
+		(r.Protocol == ProtocolAny || r2.Protocol == ProtocolAny || r.Protocol == r2.Protocol) &&
+		portsIntersect(r.SrcPorts, r2.SrcPorts) && portsIntersect(r.DstPorts, r2.DstPorts)
+}
+
+type FindingKind uint8
+
+const (
+	// FindingShadowed is a rule that never matches, because an earlier rule
+	// with a different action matches all of its packets.
+	FindingShadowed FindingKind = iota
+	// FindingRedundant is a rule that can be removed without changing the
+	// result of the ACL.
+	FindingRedundant
+	// FindingMergeable is a pair of rules that can be replaced by Merged.
+	FindingMergeable
+	// FindingOpaque is an opaque rule before Rule, the analysis does not
+	// know its packets, so the findings from Rule on may be wrong.
+	FindingOpaque
+)
+
+func (k FindingKind) String() string {
+	switch k {
+	case FindingShadowed:
+		return "shadowed"
+	case FindingRedundant:
+		return "redundant"
+	case FindingMergeable:
+		return "mergeable"
+	case FindingOpaque:
+		return "opaque"
+	}
+
+	return fmt.Sprintf("finding(%d)", uint8(k))
+}
+
+type Finding struct {
+	Kind   FindingKind
+	Rule   int // index of the affected rule
+	Other  int // index of the rule causing the finding, -1 for the default action, the opaque rule for FindingOpaque
+	Merged *Rule
+}
+
+func (f Finding) String() string {
+	switch {
+	case f.Kind == FindingMergeable:
+		return fmt.Sprintf("rules %d and %d are mergeable into: %s", f.Other, f.Rule, f.Merged)
+	case f.Kind == FindingOpaque:
+		return fmt.Sprintf("opaque rule %d before rule %d is not analyzed, the findings from there on may be wrong", f.Other, f.Rule)
+	case f.Other < 0:
+		return fmt.Sprintf("rule %d is %s by the default action", f.Rule, f.Kind)
+	}
+
+	return fmt.Sprintf("rule %d is %s by rule %d", f.Rule, f.Kind, f.Other)
+}
+
+// Analyze finds shadowed, redundant and mergeable rules. Only single rule
+// relations are detected, a rule covered by the union of several earlier
+// rules is not reported. The opaque rules are reported first, the analysis
+// treats them as if they matched nothing.
+func (a *ACL) Analyze() []Finding {
+	res := []Finding{}
+	unused := map[int]bool{}
+
+	for k, o := range a.opaque {
+		res = append(res, Finding{Kind: FindingOpaque, Rule: o.Index, Other: k})
+	}
+
+	for j := range a.rules {
+		if f, ok := a.findCovering(j); ok {
+			res = append(res, f)
+			unused[j] = true
+			continue
+		}
+
+		if other, ok := a.findLaterCovering(j); ok {
+			res = append(res, Finding{Kind: FindingRedundant, Rule: j, Other: other})
+			unused[j] = true
+		}
+	}
+
+	for j, r := range a.rules {
+		if unused[j] {
+			continue
+		}
+
+		for i := j - 1; i >= 0; i-- {
+			if unused[i] {
+				continue
+			}
+
+			merged := mergeRules(a.rules[i], r)
+			if merged != nil && !a.conflictsBetween(i, j, merged) {
+				res = append(res, Finding{Kind: FindingMergeable, Rule: j, Other: i, Merged: merged})
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// findCovering looks for an earlier rule matching every packet of rule j.
+func (a *ACL) findCovering(j int) (Finding, bool) {
+	r := a.rules[j]
+	for i := 0; i < j; i++ {
+		if !a.rules[i].Covers(r) {
+			continue
+		}
+
+		if a.rules[i].Action == r.Action {
+			return Finding{Kind: FindingRedundant, Rule: j, Other: i}, true
+		}
+		return Finding{Kind: FindingShadowed, Rule: j, Other: i}, true
+	}
+
+	return Finding{}, false
+}
+
+// findLaterCovering looks for a later rule (or the default action) with the
+// same action taking over the packets of rule j, when no rule in between
+// gives some of them a different action. A later duplicate of rule j is
+// skipped, it is reported as redundant by rule j itself.
+func (a *ACL) findLaterCovering(j int) (int, bool) {
+	r := a.rules[j]
+	for k := j + 1; k < len(a.rules); k++ {
+		later := a.rules[k]
+		if later.Action != r.Action {
+			if later.Intersects(r) {
+				return 0, false
+			}
+			continue
+		}
+
+		if later.Covers(r) && !r.Covers(later) {
+			return k, true
+		}
+	}
+
+	if a.Default == r.Action {
+		return -1, true
+	}
+
+	return 0, false
+}
+
+func (a *ACL) conflictsBetween(i, j int, merged *Rule) bool {
+	for k := i + 1; k < j; k++ {
+		if a.rules[k].Action != merged.Action && a.rules[k].Intersects(merged) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeRules returns a rule matching exactly the packets of r1 and r2, when
+// they only differ in one field and that field can be combined.
+func mergeRules(r1, r2 *Rule) *Rule {
+	if r1.Action != r2.Action || r1.Protocol != r2.Protocol {
+		return nil
+	}
+
+	merged := *r1
+	merged.Name = joinNames(r1.Name, r2.Name)
+	merged.counters = ""
+
+	differences := 0
+	mergeable := true
+	if !sameSubnet(r1.Src, r2.Src) {
+		differences++
+		merged.Src = mergeSubnets(r1.Src, r2.Src)
+		mergeable = mergeable && merged.Src != nil
+	}
+	if !sameSubnet(r1.Dst, r2.Dst) {
+		differences++
+		merged.Dst = mergeSubnets(r1.Dst, r2.Dst)
+		mergeable = mergeable && merged.Dst != nil
+	}
+	if !samePorts(r1.SrcPorts, r2.SrcPorts) {
+		differences++
+		merged.SrcPorts = mergePorts(r1.SrcPorts, r2.SrcPorts)
+		mergeable = mergeable && merged.SrcPorts != nil
+	}
+	if !samePorts(r1.DstPorts, r2.DstPorts) {
+		differences++
+		merged.DstPorts = mergePorts(r1.DstPorts, r2.DstPorts)
+		mergeable = mergeable && merged.DstPorts != nil
+	}
+
+	if differences != 1 || !mergeable {
+		return nil
+	}
+
+	return &merged
+}
+
+func joinNames(name, name2 string) string {
+	names := []string{}
+	for _, n := range []string{name, name2} {
+		if n != "" {
+			names = append(names, n)
+		}
+	}
+
+	return strings.Join(names, "+")
+}
+
+func sameSubnet(s, s2 *Subnet) bool {
+	if s == nil || s2 == nil {
+		return s == s2
+	}
+
+	return s.SameSubnet(s2)
+}
+
+// mergeSubnets returns the parent of two sibling prefixes.
+func mergeSubnets(s, s2 *Subnet) *Subnet {
+	if s == nil || s2 == nil || s.isIPv6 != s2.isIPv6 || s.NetOnes != s2.NetOnes || s.NetOnes == 0 {
+		return nil
+	}
+
+	parent := s.CloneWithOnes(s.NetOnes - 1)
+	if !parent.Contains(s2) {
+		return nil
+	}
+
+	return parent
+}
+
+func samePorts(p, p2 *PortRange) bool {
+	if p == nil || p2 == nil {
+		return p == p2
+	}
+
+	return *p == *p2
+}
+
+// mergePorts returns the union of two overlapping or adjacent port ranges.
+func mergePorts(p, p2 *PortRange) *PortRange {
+	if p == nil || p2 == nil {
+		return nil
+	}
+
+	if p.First > p2.First {
+		p, p2 = p2, p
+	}
+
+	if uint32(p2.First) > uint32(p.Last)+1 {
+		return nil
+	}
+
+	res := &PortRange{First: p.First, Last: p.Last}
+	if p2.Last > res.Last {
+		res.Last = p2.Last
+	}
+
+	return res
+}
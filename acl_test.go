@@ -0,0 +1,250 @@
+package ipcalc
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func newTestACL(t *testing.T) *ACL {
+	acl := NewACL(ActionDrop)
+	for _, r := range []*Rule{
+		{Name: "ssh-admin", Src: NewSubnet("10.0.0.0/24"), Dst: NewSubnet("192.168.1.0/24"), Protocol: ProtocolTCP, DstPorts: &PortRange{22, 22}, Action: ActionAccept},
+		{Name: "block-lab", Src: NewSubnet("10.0.0.0/8"), Protocol: ProtocolAny, Action: ActionReject},
+		{Name: "web", Dst: NewSubnet("192.168.1.10/32"), Protocol: ProtocolTCP, DstPorts: &PortRange{80, 80}, Action: ActionAccept},
+		{Name: "dns-v6", Src: NewSubnet("2001:db8::/32"), Protocol: ProtocolUDP, DstPorts: &PortRange{53, 53}, Action: ActionAccept},
+	} {
+		if err := acl.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return acl
+}
+
+func TestACLEvaluate(t *testing.T) {
+	acl := newTestACL(t)
+
+	var tests = []struct {
+		packet Packet
+		rule   int
+		action Action
+	}{
+		{Packet{net.ParseIP("10.0.0.5"), net.ParseIP("192.168.1.1"), ProtocolTCP, 40000, 22}, 0, ActionAccept},
+		{Packet{net.ParseIP("10.0.0.5"), net.ParseIP("192.168.1.1"), ProtocolTCP, 40000, 23}, 1, ActionReject},
+		{Packet{net.ParseIP("10.0.1.5"), net.ParseIP("192.168.1.1"), ProtocolTCP, 40000, 22}, 1, ActionReject},
+		{Packet{net.ParseIP("10.0.1.5"), net.ParseIP("192.168.1.10"), ProtocolTCP, 40000, 80}, 1, ActionReject},
+		{Packet{net.ParseIP("172.16.0.1"), net.ParseIP("192.168.1.10"), ProtocolTCP, 40000, 80}, 2, ActionAccept},
+		{Packet{net.ParseIP("172.16.0.1"), net.ParseIP("192.168.1.10"), ProtocolUDP, 40000, 80}, -1, ActionDrop},
+		{Packet{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db9::53"), ProtocolUDP, 40000, 53}, 3, ActionAccept},
+		{Packet{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db9::53"), ProtocolTCP, 40000, 53}, -1, ActionDrop},
+	}
+
+	for _, tt := range tests {
+		_, got := acl.Evaluate(tt.packet)
+		if got != tt.rule {
+			t.Errorf("%v: got rule %d, want %d", tt.packet, got, tt.rule)
+		}
+
+		if action := acl.Action(tt.packet); action != tt.action {
+			t.Errorf("%v: got action %s, want %s", tt.packet, action, tt.action)
+		}
+	}
+
+	// Rules added after an evaluation are picked up.
+	acl.Add(&Rule{Src: NewSubnet("172.16.0.0/12"), Protocol: ProtocolUDP, Action: ActionAccept})
+	if _, got := acl.Evaluate(Packet{net.ParseIP("172.16.0.1"), net.ParseIP("192.168.1.10"), ProtocolUDP, 40000, 80}); got != 4 {
+		t.Errorf("got rule %d, want 4", got)
+	}
+}
+
+func TestACLChangeRules(t *testing.T) {
+	acl := NewACL(ActionDrop)
+	first := &Rule{Src: NewSubnet("10.0.0.0/8"), Protocol: ProtocolAny, Action: ActionAccept}
+	acl.Add(first)
+	acl.Add(&Rule{Src: NewSubnet("192.168.0.0/16"), Protocol: ProtocolAny, Action: ActionAccept})
+
+	packet := Packet{net.ParseIP("11.0.0.1"), net.ParseIP("192.0.2.1"), ProtocolTCP, 40000, 80}
+	if _, got := acl.Evaluate(packet); got != -1 {
+		t.Errorf("got rule %d, want -1", got)
+	}
+
+	// Changing the added rule does not change the ACL.
+	first.Src = NewSubnet("11.0.0.0/8")
+	if _, got := acl.Evaluate(packet); got != -1 {
+		t.Errorf("got rule %d, want -1", got)
+	}
+
+	// Neither does changing the subnets of the returned rules in place.
+	*acl.Rules()[0].Src = *NewSubnet("11.0.0.0/8")
+	if r, _ := acl.Evaluate(Packet{net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1"), ProtocolTCP, 40000, 80}); r == nil {
+		t.Fatalf("got nil rule, want 0")
+	} else {
+		r.Src.NetInt = NewSubnet("11.0.0.0/8").NetInt
+	}
+	if _, got := acl.Evaluate(packet); got != -1 {
+		t.Errorf("got rule %d, want -1", got)
+	}
+
+	for i := 0; i < acl.Len(); i++ {
+		if err := acl.Set(i, &Rule{Src: NewSubnet("11.0.0.0/8"), Protocol: ProtocolAny, Action: ActionReject}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, got := acl.Evaluate(packet); got != 0 || r.Action != ActionReject {
+		t.Errorf("got rule %d %v, want 0", got, r)
+	}
+
+	if err := acl.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, got := acl.Evaluate(packet); got != 0 || acl.Len() != 1 {
+		t.Errorf("got rule %d of %d, want 0 of 1", got, acl.Len())
+	}
+
+	if err := acl.Set(1, first); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+	if err := acl.Remove(-1); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestACLAddInvalid(t *testing.T) {
+	acl := NewACL(ActionDrop)
+	if err := acl.Add(&Rule{Src: NewSubnet("10.0.0.0/8"), Dst: NewSubnet("2001:db8::/32")}); err == nil {
+		t.Errorf("mixing ip versions should fail")
+	}
+
+	if err := acl.Add(&Rule{DstPorts: &PortRange{80, 22}}); err == nil {
+		t.Errorf("a reversed port range should fail")
+	}
+}
+
+func TestACLAnalyze(t *testing.T) {
+	acl := NewACL(ActionDrop)
+	for _, r := range []*Rule{
+		// 0
+		{Src: NewSubnet("10.0.0.0/8"), Protocol: ProtocolTCP, DstPorts: &PortRange{22, 22}, Action: ActionAccept},
+		// 1: shadowed by 0
+		{Src: NewSubnet("10.1.0.0/16"), Protocol: ProtocolTCP, DstPorts: &PortRange{22, 22}, Action: ActionReject},
+		// 2: redundant because of 0
+		{Src: NewSubnet("10.2.0.0/16"), Protocol: ProtocolTCP, DstPorts: &PortRange{22, 22}, Action: ActionAccept},
+		// 3 and 4: mergeable into 192.168.0.0/23
+		{Src: NewSubnet("192.168.0.0/24"), Protocol: ProtocolUDP, DstPorts: &PortRange{53, 53}, Action: ActionAccept},
+		{Src: NewSubnet("192.168.1.0/24"), Protocol: ProtocolUDP, DstPorts: &PortRange{53, 53}, Action: ActionAccept},
+		// 5: redundant because of the default action
+		{Src: NewSubnet("172.16.0.0/12"), Protocol: ProtocolAny, Action: ActionDrop},
+		// 6 and 8: adjacent port ranges, but 7 is in between
+		{Src: NewSubnet("192.0.2.0/24"), Protocol: ProtocolTCP, DstPorts: &PortRange{80, 80}, Action: ActionAccept},
+		{Src: NewSubnet("192.0.2.128/25"), Protocol: ProtocolTCP, Action: ActionReject},
+		{Src: NewSubnet("192.0.2.0/24"), Protocol: ProtocolTCP, DstPorts: &PortRange{81, 90}, Action: ActionAccept},
+		// 9: redundant because of 10, nothing conflicting in between
+		{Src: NewSubnet("203.0.113.0/25"), Protocol: ProtocolUDP, Action: ActionAccept},
+		{Src: NewSubnet("203.0.113.0/24"), Protocol: ProtocolUDP, Action: ActionAccept},
+	} {
+		if err := acl.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := []string{}
+	for _, f := range acl.Analyze() {
+		got = append(got, f.String())
+	}
+
+	want := []string{
+		"rule 1 is shadowed by rule 0",
+		"rule 2 is redundant by rule 0",
+		"rule 5 is redundant by the default action",
+		"rule 9 is redundant by rule 10",
+		"rules 3 and 4 are mergeable into: accept udp 192.168.0.0/23:any -> any:53",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestACLAnalyzeDuplicates(t *testing.T) {
+	acl := NewACL(ActionDrop)
+	for _, r := range []*Rule{
+		{Src: NewSubnet("10.0.0.0/8"), Protocol: ProtocolTCP, Action: ActionAccept},
+		{Src: NewSubnet("10.0.0.0/8"), Protocol: ProtocolTCP, Action: ActionAccept},
+		// 2 and 3 are duplicates, both covered by 4
+		{Src: NewSubnet("192.0.2.0/25"), Protocol: ProtocolUDP, Action: ActionAccept},
+		{Src: NewSubnet("192.0.2.0/25"), Protocol: ProtocolUDP, Action: ActionAccept},
+		{Src: NewSubnet("192.0.2.0/24"), Protocol: ProtocolUDP, Action: ActionAccept},
+	} {
+		if err := acl.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := []string{}
+	for _, f := range acl.Analyze() {
+		got = append(got, f.String())
+	}
+
+	want := []string{
+		"rule 1 is redundant by rule 0",
+		"rule 2 is redundant by rule 4",
+		"rule 3 is redundant by rule 2",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestACLAnalyzeOpaque(t *testing.T) {
+	acl := NewACL(ActionDrop)
+	acl.Add(&Rule{Src: NewSubnet("10.0.0.0/8"), Protocol: ProtocolAny, Action: ActionAccept})
+	acl.Add(&Rule{Src: NewSubnet("10.1.0.0/16"), Protocol: ProtocolAny, Action: ActionAccept})
+	acl.AddOpaque("-A INPUT -i lo -j ACCEPT")
+	acl.Add(&Rule{Src: NewSubnet("10.2.0.0/16"), Protocol: ProtocolAny, Action: ActionDrop})
+
+	if err := acl.Remove(0); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, f := range acl.Analyze() {
+		got = append(got, f.String())
+	}
+
+	want := []string{
+		"opaque rule 0 before rule 1 is not analyzed, the findings from there on may be wrong",
+		"rule 1 is redundant by the default action",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMergePorts(t *testing.T) {
+	var tests = []struct {
+		p1, p2 PortRange
+		want   string
+	}{
+		{PortRange{80, 80}, PortRange{81, 81}, "80-81"},
+		{PortRange{81, 90}, PortRange{80, 85}, "80-90"},
+		{PortRange{80, 80}, PortRange{82, 82}, ""},
+		{PortRange{0, 65535}, PortRange{65535, 65535}, "0-65535"},
+	}
+
+	for _, tt := range tests {
+		got := mergePorts(&tt.p1, &tt.p2)
+		if got == nil {
+			if tt.want != "" {
+				t.Errorf("%v %v: got nil, want %s", tt.p1, tt.p2, tt.want)
+			}
+			continue
+		}
+
+		if got.String() != tt.want {
+			t.Errorf("%v %v: got %s, want %s", tt.p1, tt.p2, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package ipcalc
+
+import (
+	"net"
+	"strings"
+)
+
+type AddressClass uint32
+
+const (
+	ClassUnspecified AddressClass = 1 << iota
+	ClassThisNetwork
+	ClassPrivate
+	ClassSharedCGNAT
+	ClassLoopback
+	ClassLinkLocal
+	ClassMulticast
+	ClassBroadcast
+	ClassDocumentation
+	ClassBenchmarking
+	ClassUniqueLocal
+	ClassIPv4Mapped
+	Class6to4
+	ClassTeredo
+	ClassNAT64
+	ClassProtocolAssignment
+	ClassDiscard
+	ClassReserved
+)
+
+var addressClassNames = []string{
+	"unspecified",
+	"this-network",
+	"private",
+	"shared-cgnat",
+	"loopback",
+	"link-local",
+	"multicast",
+	"broadcast",
+	"documentation",
+	"benchmarking",
+	"unique-local",
+	"ipv4-mapped",
+	"6to4",
+	"teredo",
+	"nat64",
+	"protocol-assignment",
+	"discard",
+	"reserved",
+}
+
+func (c AddressClass) String() string {
+	names := []string{}
+	for i, name := range addressClassNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
+
+// MulticastScope uses the values of the IPv6 multicast scope field (RFC 7346).
+type MulticastScope uint8
+
+const (
+	ScopeNone              MulticastScope = 0x0
+	ScopeInterfaceLocal    MulticastScope = 0x1
+	ScopeLinkLocal         MulticastScope = 0x2
+	ScopeRealmLocal        MulticastScope = 0x3
+	ScopeAdminLocal        MulticastScope = 0x4
+	ScopeSiteLocal         MulticastScope = 0x5
+	ScopeOrganizationLocal MulticastScope = 0x8
+	ScopeGlobal            MulticastScope = 0xe
+)
+
+func (m MulticastScope) String() string {
+	switch m {
+	case ScopeNone:
+		return "none"
+	case ScopeInterfaceLocal:
+		return "interface-local"
+	case ScopeLinkLocal:
+		return "link-local"
+	case ScopeRealmLocal:
+		return "realm-local"
+	case ScopeAdminLocal:
+		return "admin-local"
+	case ScopeSiteLocal:
+		return "site-local"
+	case ScopeOrganizationLocal:
+		return "organization-local"
+	case ScopeGlobal:
+		return "global"
+	}
+
+	return "unassigned"
+}
+
+// SpecialPurpose is one entry of the IANA special-purpose address registries.
+type SpecialPurpose struct {
+	Cidr   string
+	Name   string
+	RFC    string
+	Class  AddressClass
+	Global bool // the "Globally Reachable" column of the registry
+}
+
+// Multicast blocks are not in the special-purpose registries, they are never
+// valid unicast destinations, so they are not Global here.
+var specialPurposes = []SpecialPurpose{
+	{"0.0.0.0/8", "This network", "RFC 791", ClassThisNetwork, false},
+	{"0.0.0.0/32", "This host on this network", "RFC 1122", ClassUnspecified, false},
+	{"10.0.0.0/8", "Private-Use", "RFC 1918", ClassPrivate, false},
+	{"100.64.0.0/10", "Shared Address Space", "RFC 6598", ClassSharedCGNAT, false},
+	{"127.0.0.0/8", "Loopback", "RFC 1122", ClassLoopback, false},
+	{"169.254.0.0/16", "Link Local", "RFC 3927", ClassLinkLocal, false},
+	{"172.16.0.0/12", "Private-Use", "RFC 1918", ClassPrivate, false},
+	{"192.0.0.0/24", "IETF Protocol Assignments", "RFC 6890", ClassProtocolAssignment, false},
+	{"192.0.0.0/29", "IPv4 Service Continuity Prefix", "RFC 7335", ClassProtocolAssignment, false},
+	{"192.0.0.8/32", "IPv4 dummy address", "RFC 7600", ClassProtocolAssignment, false},
+	{"192.0.0.9/32", "Port Control Protocol Anycast", "RFC 7723", ClassProtocolAssignment, true},
+	{"192.0.0.10/32", "Traversal Using Relays around NAT Anycast", "RFC 8155", ClassProtocolAssignment, true},
+	{"192.0.0.170/31", "NAT64/DNS64 Discovery", "RFC 8880", ClassProtocolAssignment | ClassNAT64, false},
+	{"192.0.2.0/24", "Documentation (TEST-NET-1)", "RFC 5737", ClassDocumentation, false},
+	{"192.31.196.0/24", "AS112-v4", "RFC 7535", ClassProtocolAssignment, true},
+	{"192.52.193.0/24", "AMT", "RFC 7450", ClassProtocolAssignment, true},
+	{"192.88.99.0/24", "Deprecated (6to4 Relay Anycast)", "RFC 7526", Class6to4 | ClassReserved, false},
+	{"192.168.0.0/16", "Private-Use", "RFC 1918", ClassPrivate, false},
+	{"192.175.48.0/24", "Direct Delegation AS112 Service", "RFC 7534", ClassProtocolAssignment, true},
+	{"198.18.0.0/15", "Benchmarking", "RFC 2544", ClassBenchmarking, false},
+	{"198.51.100.0/24", "Documentation (TEST-NET-2)", "RFC 5737", ClassDocumentation, false},
+	{"203.0.113.0/24", "Documentation (TEST-NET-3)", "RFC 5737", ClassDocumentation, false},
+	{"224.0.0.0/4", "Multicast", "RFC 5771", ClassMulticast, false},
+	{"240.0.0.0/4", "Reserved", "RFC 1112", ClassReserved, false},
+	{"255.255.255.255/32", "Limited Broadcast", "RFC 919", ClassBroadcast, false},
+
+	{"::/128", "Unspecified Address", "RFC 4291", ClassUnspecified, false},
+	{"::1/128", "Loopback Address", "RFC 4291", ClassLoopback, false},
+	{"::ffff:0:0/96", "IPv4-mapped Address", "RFC 4291", ClassIPv4Mapped, false},
+	{"64:ff9b::/96", "IPv4-IPv6 Translat.", "RFC 6052", ClassNAT64, true},
+	{"64:ff9b:1::/48", "IPv4-IPv6 Translat.", "RFC 8215", ClassNAT64, false},
+	{"100::/64", "Discard-Only Address Block", "RFC 6666", ClassDiscard, false},
+	{"2001::/23", "IETF Protocol Assignments", "RFC 2928", ClassProtocolAssignment, false},
+	{"2001::/32", "TEREDO", "RFC 4380", ClassTeredo, true},
+	{"2001:1::1/128", "Port Control Protocol Anycast", "RFC 7723", ClassProtocolAssignment, true},
+	{"2001:1::2/128", "Traversal Using Relays around NAT Anycast", "RFC 8155", ClassProtocolAssignment, true},
+	{"2001:2::/48", "Benchmarking", "RFC 5180", ClassBenchmarking, false},
+	{"2001:3::/32", "AMT", "RFC 7450", ClassProtocolAssignment, true},
+	{"2001:4:112::/48", "AS112-v6", "RFC 7535", ClassProtocolAssignment, true},
+	{"2001:10::/28", "Deprecated (previously ORCHID)", "RFC 4843", ClassReserved, false},
+	{"2001:20::/28", "ORCHIDv2", "RFC 7343", ClassProtocolAssignment, true},
+	{"2001:30::/28", "Drone Remote ID Protocol Entity Tags (DETs) Prefix", "RFC 9374", ClassProtocolAssignment, true},
+	{"2001:db8::/32", "Documentation", "RFC 3849", ClassDocumentation, false},
+	{"2002::/16", "6to4", "RFC 3056", Class6to4, true},
+	{"2620:4f:8000::/48", "Direct Delegation AS112 Service", "RFC 7534", ClassProtocolAssignment, true},
+	{"3fff::/20", "Documentation", "RFC 9637", ClassDocumentation, false},
+	{"5f00::/16", "Segment Routing (SRv6) SIDs", "RFC 9602", ClassReserved, false},
+	{"fc00::/7", "Unique-Local", "RFC 4193", ClassUniqueLocal, false},
+	{"fe80::/10", "Link-Local Unicast", "RFC 4291", ClassLinkLocal, false},
+	{"ff00::/8", "Multicast", "RFC 4291", ClassMulticast, false},
+
+	// Everything outside of 2000::/3 is reserved by the IETF in the IPv6
+	// address space registry, apart from the blocks above.
+	{"::/8", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"100::/8", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"200::/7", "Reserved by IETF", "RFC 4048", ClassReserved, false},
+	{"400::/6", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"800::/5", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"1000::/4", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"4000::/3", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"6000::/3", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"8000::/3", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"a000::/3", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"c000::/3", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"e000::/4", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"f000::/5", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"f800::/6", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"fe00::/9", "Reserved by IETF", "RFC 4291", ClassReserved, false},
+	{"fec0::/10", "Deprecated (site-local)", "RFC 3879", ClassReserved, false},
+}
+
+var specialPurposeTable, specialPurposeByCidr = buildSpecialPurposeTable()
+
+func buildSpecialPurposeTable() (*Table, map[string]*SpecialPurpose) {
+	table := NewTable()
+	byCidr := map[string]*SpecialPurpose{}
+
+	for i := range specialPurposes {
+		entry := &specialPurposes[i]
+		if _, err := table.InsertCidr(entry.Cidr, entry.Name); err != nil {
+			panic("ipcalc: bad special-purpose registry entry " + entry.Cidr + ": " + err.Error())
+		}
+		byCidr[NewSubnet(entry.Cidr).GetCidr()] = entry
+	}
+
+	return table, byCidr
+}
+
+// SpecialPurposes returns a copy of the embedded registry.
+func SpecialPurposes() []SpecialPurpose {
+	return append([]SpecialPurpose(nil), specialPurposes...)
+}
+
+type Classification struct {
+	Class  AddressClass
+	Scope  MulticastScope
+	Global bool
+
+	// Entries are the registry entries covering the address, the most
+	// specific one first. They are copies, changing them does not change
+	// the registry.
+	Entries []SpecialPurpose
+}
+
+func (c Classification) Is(class AddressClass) bool {
+	return c.Class&class != 0
+}
+
+// IsBogon reports whether the address should not appear as a source or
+// destination on the public internet.
+func (c Classification) IsBogon() bool {
+	return !c.Global
+}
+
+func Classify(ip net.IP) Classification {
+	s := newHostSubnet(ip)
+	if s == nil {
+		return Classification{}
+	}
+
+	return s.Classification()
+}
+
+func IsBogon(ip net.IP) bool {
+	return Classify(ip).IsBogon()
+}
+
+// Classification returns the classes of the registry entries covering the
+// whole subnet. A prefix larger than an entry does not get its class.
+func (s *Subnet) Classification() Classification {
+	res := Classification{Global: true}
+
+	node, err := specialPurposeTable.Lookup(s)
+	if err != nil {
+		return res
+	}
+
+	for ; node != nil; node = node.parent {
+		if node.isDummy {
+			continue
+		}
+
+		entry := specialPurposeByCidr[node.GetCidr()]
+		if len(res.Entries) == 0 {
+			res.Global = entry.Global
+		}
+		res.Entries = append(res.Entries, *entry)
+		res.Class |= entry.Class
+	}
+
+	if res.Class&ClassMulticast != 0 {
+		res.Scope = s.multicastScope()
+	}
+
+	return res
+}
+
+var ipv4MulticastScopes = []struct {
+	subnet *Subnet
+	scope  MulticastScope
+}{
+	// The most specific blocks first.
+	{NewSubnet("224.0.0.0/24"), ScopeLinkLocal},
+	{NewSubnet("239.255.0.0/16"), ScopeSiteLocal},
+	{NewSubnet("239.192.0.0/14"), ScopeOrganizationLocal},
+	{NewSubnet("239.0.0.0/8"), ScopeAdminLocal},
+}
+
+func (s *Subnet) multicastScope() MulticastScope {
+	if s.isIPv6 {
+		if s.NetOnes < 16 {
+			return ScopeNone
+		}
+		return MulticastScope(s.NetInt.Hi >> 48 & 0x0f)
+	}
+
+	for _, block := range ipv4MulticastScopes {
+		if block.subnet.Covers(s) {
+			return block.scope
+		}
+	}
+
+	if s.NetOnes < 4 {
+		return ScopeNone
+	}
+
+	return ScopeGlobal
+}
@@ -0,0 +1,119 @@
+package ipcalc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	var tests = []struct {
+		ip     string
+		class  AddressClass
+		scope  MulticastScope
+		global bool
+	}{
+		{"8.8.8.8", 0, ScopeNone, true},
+		{"10.1.2.3", ClassPrivate, ScopeNone, false},
+		{"172.31.255.255", ClassPrivate, ScopeNone, false},
+		{"172.32.0.0", 0, ScopeNone, true},
+		{"192.168.1.1", ClassPrivate, ScopeNone, false},
+		{"100.64.0.1", ClassSharedCGNAT, ScopeNone, false},
+		{"100.128.0.1", 0, ScopeNone, true},
+		{"127.0.0.1", ClassLoopback, ScopeNone, false},
+		{"169.254.1.1", ClassLinkLocal, ScopeNone, false},
+		{"0.0.0.0", ClassThisNetwork | ClassUnspecified, ScopeNone, false},
+		{"0.1.2.3", ClassThisNetwork, ScopeNone, false},
+		{"192.0.0.9", ClassProtocolAssignment, ScopeNone, true},
+		{"192.0.0.170", ClassProtocolAssignment | ClassNAT64, ScopeNone, false},
+		{"192.0.2.55", ClassDocumentation, ScopeNone, false},
+		{"198.19.0.1", ClassBenchmarking, ScopeNone, false},
+		{"224.0.0.251", ClassMulticast, ScopeLinkLocal, false},
+		{"232.1.1.1", ClassMulticast, ScopeGlobal, false},
+		{"239.255.255.250", ClassMulticast, ScopeSiteLocal, false},
+		{"239.192.0.1", ClassMulticast, ScopeOrganizationLocal, false},
+		{"239.1.1.1", ClassMulticast, ScopeAdminLocal, false},
+		{"240.0.0.1", ClassReserved, ScopeNone, false},
+		{"255.255.255.255", ClassReserved | ClassBroadcast, ScopeNone, false},
+
+		{"2001:4860:4860::8888", 0, ScopeNone, true},
+		{"::", ClassReserved | ClassUnspecified, ScopeNone, false},
+		{"::1", ClassReserved | ClassLoopback, ScopeNone, false},
+		{"fe80::1", ClassLinkLocal, ScopeNone, false},
+		{"fd00::1", ClassUniqueLocal, ScopeNone, false},
+		{"2001:db8::1", ClassDocumentation, ScopeNone, false},
+		{"3fff::1", ClassDocumentation, ScopeNone, false},
+		{"2002:c000:204::1", Class6to4, ScopeNone, true},
+		{"2001:0:4136:e378::1", ClassProtocolAssignment | ClassTeredo, ScopeNone, true},
+		{"2001:2::1", ClassProtocolAssignment | ClassBenchmarking, ScopeNone, false},
+		{"64:ff9b::c000:201", ClassReserved | ClassNAT64, ScopeNone, true},
+		{"64:ff9b:1::1", ClassReserved | ClassNAT64, ScopeNone, false},
+		{"100::1", ClassReserved | ClassDiscard, ScopeNone, false},
+		{"ff02::1", ClassMulticast, ScopeLinkLocal, false},
+		{"ff05::2", ClassMulticast, ScopeSiteLocal, false},
+		{"ff0e::101", ClassMulticast, ScopeGlobal, false},
+		{"4000::1", ClassReserved, ScopeNone, false},
+	}
+
+	for _, tt := range tests {
+		got := Classify(net.ParseIP(tt.ip))
+		if got.Class != tt.class {
+			t.Errorf("%s: got class %s, want %s", tt.ip, got.Class, tt.class)
+		}
+		if got.Scope != tt.scope {
+			t.Errorf("%s: got scope %s, want %s", tt.ip, got.Scope, tt.scope)
+		}
+		if got.Global != tt.global {
+			t.Errorf("%s: got global %t, want %t", tt.ip, got.Global, tt.global)
+		}
+		if IsBogon(net.ParseIP(tt.ip)) == tt.global {
+			t.Errorf("%s: IsBogon should be %t", tt.ip, !tt.global)
+		}
+	}
+}
+
+func TestSubnetClassification(t *testing.T) {
+	var tests = []struct {
+		cidr    string
+		class   AddressClass
+		entries int
+	}{
+		{"10.0.0.0/8", ClassPrivate, 1},
+		{"10.20.0.0/16", ClassPrivate, 1},
+		{"10.0.0.0/7", 0, 0},
+		{"0.0.0.0/0", 0, 0},
+		{"192.0.0.0/30", ClassProtocolAssignment, 2},
+		{"ff00::/8", ClassMulticast, 1},
+		{"::ffff:10.0.0.0/104", ClassReserved | ClassIPv4Mapped, 2},
+	}
+
+	for _, tt := range tests {
+		got := NewSubnet(tt.cidr).Classification()
+		if got.Class != tt.class {
+			t.Errorf("%s: got class %s, want %s", tt.cidr, got.Class, tt.class)
+		}
+		if len(got.Entries) != tt.entries {
+			t.Errorf("%s: got %d entries, want %d", tt.cidr, len(got.Entries), tt.entries)
+		}
+	}
+
+	got := NewSubnet("192.0.0.0/29").Classification()
+	if got.Entries[0].RFC != "RFC 7335" || got.Entries[1].RFC != "RFC 6890" {
+		t.Errorf("entries are not ordered most specific first: %v %v", got.Entries[0], got.Entries[1])
+	}
+
+	got.Entries[0].Global = true
+	got.Entries[0].RFC = "changed"
+	if again := NewSubnet("192.0.0.0/29").Classification(); again.Entries[0].RFC != "RFC 7335" || again.Global {
+		t.Errorf("got %v, want the registry unchanged", again.Entries[0])
+	}
+}
+
+func TestAddressClassString(t *testing.T) {
+	if got := (ClassPrivate | ClassReserved).String(); got != "private|reserved" {
+		t.Errorf("got %s, want private|reserved", got)
+	}
+
+	if got := AddressClass(0).String(); got != "none" {
+		t.Errorf("got %s, want none", got)
+	}
+}
@@ -0,0 +1,146 @@
+package ipcalc
+
+import (
+	"fmt"
+	"net"
+)
+
+const frozenChunkFlag uint32 = 1 << 31
+
+// FrozenIPv4 is a read-only DIR-16-8-8 longest-prefix match table built from
+// an IPv4 Subnet tree. Every lookup costs at most three table accesses.
+type FrozenIPv4 struct {
+	root  *Subnet
+	nodes []*Subnet // nodes[0] is the "no match" entry
+
+	tbl16 []uint32 // indexed by the first two octets
+	tbl24 []uint32 // 256 entry chunks, indexed by the third octet
+	tbl32 []uint32 // 256 entry chunks, indexed by the fourth octet
+}
+
+func (s *Subnet) FreezeIPv4() (*FrozenIPv4, error) {
+	f := &FrozenIPv4{root: s}
+	if err := f.Rebuild(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Rebuild recreates the lookup tables from the current state of the tree.
+func (f *FrozenIPv4) Rebuild() error {
+	if f.root == nil {
+		return fmt.Errorf("frozen table has no root")
+	}
+
+	if f.root.isIPv6 {
+		return fmt.Errorf("frozen table supports only ipv4 trees")
+	}
+
+	f.nodes = []*Subnet{nil}
+	f.tbl16 = make([]uint32, 1<<16)
+	f.tbl24 = nil
+	f.tbl32 = nil
+
+	// The root is the default answer of Subnet.Lookup, even if it is a dummy.
+	f.add(f.root)
+	for _, child := range f.root.children {
+		f.addTree(child)
+	}
+
+	return nil
+}
+
+// addTree adds the real nodes of the subtree in pre-order, so every prefix
+// overwrites the entries of its ancestors but never the ones of its
+// descendants.
+func (f *FrozenIPv4) addTree(s *Subnet) {
+	if s == nil {
+		return
+	}
+
+	if !s.isDummy {
+		f.add(s)
+	}
+
+	for _, child := range s.children {
+		f.addTree(child)
+	}
+}
+
+func (f *FrozenIPv4) add(s *Subnet) {
+	idx := uint32(len(f.nodes))
+	f.nodes = append(f.nodes, s)
+
+	start := uint32(s.NetInt.Lo)
+	ones := uint(s.NetOnes)
+
+	if ones <= 16 {
+		fillEntries(f.tbl16, start>>16, 1<<(16-ones), idx)
+		return
+	}
+
+	chunk24 := f.chunk(&f.tbl24, &f.tbl16[start>>16])
+	if ones <= 24 {
+		fillEntries(f.tbl24, chunk24<<8|(start>>8)&0xff, 1<<(24-ones), idx)
+		return
+	}
+
+	chunk32 := f.chunk(&f.tbl32, &f.tbl24[chunk24<<8|(start>>8)&0xff])
+	fillEntries(f.tbl32, chunk32<<8|start&0xff, 1<<(32-ones), idx)
+}
+
+// chunk returns the index of the next level chunk the entry points to. A
+// plain entry is expanded into a new chunk inheriting its value.
+func (f *FrozenIPv4) chunk(tbl *[]uint32, entry *uint32) uint32 {
+	if *entry&frozenChunkFlag != 0 {
+		return *entry &^ frozenChunkFlag
+	}
+
+	idx := uint32(len(*tbl) >> 8)
+	value := *entry
+	for i := 0; i < 256; i++ {
+		*tbl = append(*tbl, value)
+	}
+	*entry = idx | frozenChunkFlag
+
+	return idx
+}
+
+func fillEntries(tbl []uint32, first, count, value uint32) {
+	for i := first; i < first+count; i++ {
+		tbl[i] = value
+	}
+}
+
+// Lookup returns the most specific prefix containing ip, or nil when there is
+// none or the table was never built.
+func (f *FrozenIPv4) Lookup(ip net.IP) *Subnet {
+	ipv4 := ip.To4()
+	if ipv4 == nil || f.tbl16 == nil {
+		return nil
+	}
+
+	entry := f.tbl16[uint32(ipv4[0])<<8|uint32(ipv4[1])]
+	if entry&frozenChunkFlag != 0 {
+		entry = f.tbl24[(entry&^frozenChunkFlag)<<8|uint32(ipv4[2])]
+		if entry&frozenChunkFlag != 0 {
+			entry = f.tbl32[(entry&^frozenChunkFlag)<<8|uint32(ipv4[3])]
+		}
+	}
+
+	return f.nodes[entry]
+}
+
+func (f *FrozenIPv4) LookupString(ip string) *Subnet {
+	return f.Lookup(net.ParseIP(ip))
+}
+
+// Len returns the number of prefixes in the table, including the root.
+func (f *FrozenIPv4) Len() int {
+	if len(f.nodes) == 0 {
+		return 0
+	}
+
+	return len(f.nodes) - 1
+}
@@ -0,0 +1,175 @@
+package ipcalc
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func randIPv4Tree(base string, n int) *Subnet {
+	root := NewSubnet(base)
+	for i := 0; i < n; i++ {
+		s := NewSubnet(fmt.Sprintf("%s/%d", randIPv4Addr(), 8+rand.Uint32()%25))
+		if root.Contains(s) {
+			root.Insert(s)
+		}
+	}
+
+	return root
+}
+
+func checkFrozenEquivalence(t *testing.T, root *Subnet, f *FrozenIPv4, ipStr string) {
+	t.Helper()
+
+	// Lookup returns nil with its error when the address is outside root.
+	want, _ := root.Lookup(NewSubnet(ipStr + "/32"))
+	got := f.LookupString(ipStr)
+	if got != want {
+		t.Errorf("lookup %s: got %v, want %v", ipStr, got, want)
+	}
+}
+
+func TestFrozenIPv4Lookup(t *testing.T) {
+	root := NewSubnet("10.0.0.0/8")
+	for _, cidr := range []string{
+		"10.1.0.0/16",
+		"10.1.2.0/24",
+		"10.1.2.128/25",
+		"10.1.2.130/32",
+		"10.200.0.0/13",
+		"10.1.3.0/24",
+	} {
+		root.Insert(NewSubnet(cidr))
+	}
+
+	f, err := root.FreezeIPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		ip, want string
+	}{
+		{"10.0.0.1", "10.0.0.0/8"},
+		{"10.1.0.1", "10.1.0.0/16"},
+		{"10.1.2.1", "10.1.2.0/24"},
+		{"10.1.2.129", "10.1.2.128/25"},
+		{"10.1.2.130", "10.1.2.130/32"},
+		{"10.1.2.131", "10.1.2.128/25"},
+		{"10.1.3.255", "10.1.3.0/24"},
+		{"10.1.4.0", "10.1.0.0/16"},
+		{"10.207.255.255", "10.200.0.0/13"},
+		{"10.208.0.0", "10.0.0.0/8"},
+		{"11.0.0.0", ""},
+		{"2001:db8::1", ""},
+	}
+
+	for _, tt := range tests {
+		got := f.LookupString(tt.ip)
+		if got == nil {
+			if tt.want != "" {
+				t.Errorf("lookup %s: got nil, want %s", tt.ip, tt.want)
+			}
+			continue
+		}
+
+		if got.GetCidr() != tt.want {
+			t.Errorf("lookup %s: got %s, want %s", tt.ip, got.GetCidr(), tt.want)
+		}
+	}
+
+	if f.Len() != 7 {
+		t.Errorf("got len %d, want 7", f.Len())
+	}
+}
+
+func TestFrozenIPv4RandomEquivalence(t *testing.T) {
+	root := randIPv4Tree("0.0.0.0/0", 5000)
+
+	f, err := root.FreezeIPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20000; i++ {
+		checkFrozenEquivalence(t, root, f, randIPv4Addr())
+	}
+
+	// The edges of every prefix are the interesting addresses.
+	var check func(s *Subnet)
+	check = func(s *Subnet) {
+		if s == nil {
+			return
+		}
+		last := intToIPv4(s.NetInt.Or(s.MaskInt.Xor64(0xffffffff)))
+		checkFrozenEquivalence(t, root, f, s.GetNetworkStr())
+		checkFrozenEquivalence(t, root, f, last.String())
+		for _, child := range s.children {
+			check(child)
+		}
+	}
+	check(root)
+}
+
+func TestFrozenIPv4Rebuild(t *testing.T) {
+	root := randIPv4Tree("172.16.0.0/12", 500)
+
+	f, err := root.FreezeIPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root.Insert(NewSubnet("172.31.255.255/32"))
+	if got := f.LookupString("172.31.255.255"); got != nil && got.NetOnes == 32 {
+		t.Errorf("frozen table changed before rebuild")
+	}
+
+	if err := f.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5000; i++ {
+		ip := net.IPv4(172, 16|byte(rand.Uint32()%16), byte(rand.Uint32()), byte(rand.Uint32()))
+		checkFrozenEquivalence(t, root, f, ip.String())
+	}
+	checkFrozenEquivalence(t, root, f, "172.31.255.255")
+}
+
+func TestFrozenIPv4RejectsIPv6(t *testing.T) {
+	_, err := NewSubnet("2001:db8::/32").FreezeIPv4()
+	if err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestFrozenIPv4Unbuilt(t *testing.T) {
+	var f FrozenIPv4
+	if got := f.LookupString("10.0.0.1"); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+	if f.Len() != 0 {
+		t.Errorf("got len %d, want 0", f.Len())
+	}
+}
+
+func BenchmarkFrozenIPv4Lookup(b *testing.B) {
+	root := randIPv4Tree("0.0.0.0/0", 10000)
+	f, _ := root.FreezeIPv4()
+	ip := net.ParseIP(randIPv4Addr())
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		f.Lookup(ip)
+	}
+}
+
+func BenchmarkSubnetLookup(b *testing.B) {
+	root := randIPv4Tree("0.0.0.0/0", 10000)
+	s := NewSubnet(randIPv4Addr() + "/32")
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		root.Lookup(s)
+	}
+}
@@ -0,0 +1,140 @@
+package ipcalc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GraphOptions limit the rendered part of a tree.
+type GraphOptions struct {
+	// Subtree starts the graph at the node covering this subnet most
+	// specifically, instead of the root.
+	Subtree *Subnet
+	// MaxDepth limits the levels below the start node, 0 means no limit.
+	// Cut subtrees are drawn as a single node with their number of prefixes.
+	MaxDepth int
+}
+
+type graphNode struct {
+	id      string
+	subnet  *Subnet
+	hidden  int // prefixes below a cut, when subnet is nil
+	parent  *graphNode
+	edgeBit string
+}
+
+// graph lists the nodes to render in pre-order.
+func (s *Subnet) graph(opts GraphOptions) []*graphNode {
+	start := s
+	if opts.Subtree != nil {
+		for child := start; child != nil && child.Covers(opts.Subtree); {
+			start = child
+			if child.NetOnes == opts.Subtree.NetOnes {
+				break
+			}
+			child = child.children[opts.Subtree.bitValue(child.targetBitPosition())]
+		}
+	}
+
+	nodes := []*graphNode{}
+	var visit func(n *Subnet, parent *graphNode, edgeBit string, depth int)
+	visit = func(n *Subnet, parent *graphNode, edgeBit string, depth int) {
+		node := &graphNode{id: fmt.Sprintf("n%d", len(nodes)), parent: parent, edgeBit: edgeBit}
+		nodes = append(nodes, node)
+
+		if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+			node.hidden = countNodes(n)
+			return
+		}
+		node.subnet = n
+
+		for bitVal, child := range n.children {
+			if child != nil {
+				label := fmt.Sprintf("bit %d = %d", n.NetOnes+1, bitVal)
+				visit(child, node, label, depth+1)
+			}
+		}
+	}
+	visit(start, nil, "", 0)
+
+	return nodes
+}
+
+func (n *graphNode) label(newline string) string {
+	if n.subnet == nil {
+		return fmt.Sprintf("%d more", n.hidden)
+	}
+
+	label := n.subnet.GetCidr()
+	if n.subnet.Meta != "" {
+		label += newline + n.subnet.Meta
+	}
+
+	return label
+}
+
+func dotQuote(str string) string {
+	str = strings.Replace(str, `\`, `\\`, -1)
+	str = strings.Replace(str, `"`, `\"`, -1)
+	return `"` + strings.Replace(str, "\n", `\n`, -1) + `"`
+}
+
+// WriteDOT writes the tree in the Graphviz DOT format. Dummy nodes are gray
+// and dashed, edges are labelled with the bit they branch on.
+func (s *Subnet) WriteDOT(w io.Writer, opts GraphOptions) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph subnets {\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	for _, n := range s.graph(opts) {
+		attrs := []string{"label=" + dotQuote(n.label("\n"))}
+		switch {
+		case n.subnet == nil:
+			attrs = append(attrs, "shape=plaintext")
+		case n.subnet.isDummy:
+			attrs = append(attrs, "style=dashed", "color=gray", "fontcolor=gray")
+		}
+		fmt.Fprintf(b, "\t%s [%s];\n", n.id, strings.Join(attrs, ", "))
+
+		if n.parent != nil {
+			fmt.Fprintf(b, "\t%s -> %s [label=%s];\n", n.parent.id, n.id, dotQuote(n.edgeBit))
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidQuote(str string) string {
+	str = strings.Replace(str, `"`, "#quot;", -1)
+	return `"` + strings.Replace(str, "\n", "<br/>", -1) + `"`
+}
+
+// WriteMermaid writes the tree as a Mermaid flowchart, with the same look as
+// WriteDOT.
+func (s *Subnet) WriteMermaid(w io.Writer, opts GraphOptions) error {
+	b := &strings.Builder{}
+	b.WriteString("flowchart TD\n")
+	b.WriteString("\tclassDef dummy stroke-dasharray:5 5,color:gray\n")
+	b.WriteString("\tclassDef more stroke-width:0px\n")
+
+	for _, n := range s.graph(opts) {
+		fmt.Fprintf(b, "\t%s[%s]", n.id, mermaidQuote(n.label("\n")))
+		switch {
+		case n.subnet == nil:
+			b.WriteString(":::more")
+		case n.subnet.isDummy:
+			b.WriteString(":::dummy")
+		}
+		b.WriteString("\n")
+
+		if n.parent != nil {
+			fmt.Fprintf(b, "\t%s -->|%s| %s\n", n.parent.id, mermaidQuote(n.edgeBit), n.id)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
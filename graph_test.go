@@ -0,0 +1,80 @@
+package ipcalc
+
+import (
+	"strings"
+	"testing"
+)
+
+func newGraphTestTree() *Subnet {
+	root := NewSubnet("10.0.0.0/8")
+	root.Meta = `corp "hq"`
+	for _, cidr := range []string{"10.0.0.0/24", "10.0.1.0/24", "10.128.0.0/9", "10.128.0.0/16"} {
+		root.Insert(NewSubnet(cidr))
+	}
+
+	return root
+}
+
+func TestWriteDOT(t *testing.T) {
+	b := &strings.Builder{}
+	if err := newGraphTestTree().WriteDOT(b, GraphOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `digraph subnets {
+	node [shape=box, fontname="monospace"];
+	n0 [label="10.0.0.0/8\ncorp \"hq\""];
+	n1 [label="10.0.0.0/23", style=dashed, color=gray, fontcolor=gray];
+	n0 -> n1 [label="bit 9 = 0"];
+	n2 [label="10.0.0.0/24"];
+	n1 -> n2 [label="bit 24 = 0"];
+	n3 [label="10.0.1.0/24"];
+	n1 -> n3 [label="bit 24 = 1"];
+	n4 [label="10.128.0.0/9"];
+	n0 -> n4 [label="bit 9 = 1"];
+	n5 [label="10.128.0.0/16"];
+	n4 -> n5 [label="bit 10 = 0"];
+}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	b := &strings.Builder{}
+	if err := newGraphTestTree().WriteMermaid(b, GraphOptions{MaxDepth: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `flowchart TD
+	classDef dummy stroke-dasharray:5 5,color:gray
+	classDef more stroke-width:0px
+	n0["10.0.0.0/8<br/>corp #quot;hq#quot;"]
+	n1["10.0.0.0/23"]:::dummy
+	n0 -->|"bit 9 = 0"| n1
+	n2["1 more"]:::more
+	n1 -->|"bit 24 = 0"| n2
+	n3["1 more"]:::more
+	n1 -->|"bit 24 = 1"| n3
+	n4["10.128.0.0/9"]
+	n0 -->|"bit 9 = 1"| n4
+	n5["1 more"]:::more
+	n4 -->|"bit 10 = 0"| n5
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGraphSubtree(t *testing.T) {
+	b := &strings.Builder{}
+	opts := GraphOptions{Subtree: NewSubnet("10.0.1.128/25")}
+	if err := newGraphTestTree().WriteDOT(b, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.String(); !strings.Contains(got, `n0 [label="10.0.1.0/24"];`) || strings.Contains(got, "n1") {
+		t.Errorf("got\n%s\nwant only 10.0.1.0/24", got)
+	}
+}
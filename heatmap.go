@@ -0,0 +1,428 @@
+package ipcalc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vrgakos/uint128"
+)
+
+// HeatmapOptions configure a Hilbert curve heatmap of a prefix.
+type HeatmapOptions struct {
+	// Prefix is the rendered address space, the heatmap's node by default.
+	Prefix *Subnet
+	// CellBits is the prefix length of one cell. The difference to the
+	// length of Prefix has to be even, so the map is a square. By default
+	// it is at most 16 bits longer than Prefix: a 256x256 map.
+	CellBits uint8
+	// LabelBits is the prefix length of the labelled blocks, 4 bits longer
+	// than Prefix by default: 16 blocks. The difference to the length of
+	// Prefix has to be even. NoLabels turns the labels off.
+	LabelBits uint8
+	NoLabels  bool
+	// CellSize is the size of a cell in pixels, by default the map is
+	// about 512 pixels wide.
+	CellSize int
+
+	// Value returns the value of a node. Cells are coloured by the highest
+	// value of the nodes inside them, or by the most specific node covering
+	// them. Without Value, cells show the share of their addresses covered
+	// by the nodes below Prefix: the utilisation of a pool.
+	Value func(*Subnet) (float64, bool)
+	// Min and Max are the range of the colour scale, the range of the
+	// values when both are 0.
+	Min, Max float64
+}
+
+// MetaValue reads the Meta of a node as a number, for HeatmapOptions.Value.
+func MetaValue(s *Subnet) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s.Meta), 64)
+	return v, err == nil
+}
+
+type heatmapLabel struct {
+	prefix     *Subnet
+	x, y, side int // in cells
+}
+
+// Heatmap maps the cells of a prefix along a Hilbert curve, so neighbouring
+// prefixes are close to each other on the map.
+type Heatmap struct {
+	Prefix   *Subnet
+	CellBits uint8
+	Side     int // cells per side
+	CellSize int
+	Min, Max float64
+
+	values []float64
+	has    []bool
+	labels []heatmapLabel
+}
+
+const heatmapMaxCellBits = 24
+
+// hilbertXY returns the position of the d-th cell on a Hilbert curve
+// filling a side x side square.
+func hilbertXY(side int, d uint64) (int, int) {
+	x, y := 0, 0
+	for s := 1; s < side; s *= 2 {
+		rx := int(d/2) & 1
+		ry := int(d^uint64(rx)) & 1
+		if ry == 0 {
+			if rx == 1 {
+				x, y = s-1-x, s-1-y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		d /= 4
+	}
+
+	return x, y
+}
+
+// hilbertIndex is the inverse of hilbertXY.
+func hilbertIndex(side, x, y int) uint64 {
+	var d uint64
+	for s := side / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s != 0 {
+			rx = 1
+		}
+		if y&s != 0 {
+			ry = 1
+		}
+		d += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = side-1-x, side-1-y
+			}
+			x, y = y, x
+		}
+	}
+
+	return d
+}
+
+// cellRange returns the cells of s, which has to intersect the prefix.
+func (h *Heatmap) cellRange(s *Subnet) (uint64, uint64) {
+	prefixOnes := int(h.Prefix.NetOnes)
+	cellBits := int(h.CellBits)
+	if int(s.NetOnes) <= prefixOnes {
+		return 0, uint64(len(h.values))
+	}
+
+	shift := uint(int(s.totalNumberOfBits()) - cellBits)
+	first := s.NetInt.Sub(h.Prefix.NetInt)
+	if int(s.NetOnes) >= cellBits {
+		return first.Rsh(shift).Lo, first.Rsh(shift).Lo + 1
+	}
+
+	start := first.Rsh(shift).Lo
+	return start, start + 1<<uint(cellBits-int(s.NetOnes))
+}
+
+// Heatmap computes a heatmap of the prefixes in the tree of s.
+func (s *Subnet) Heatmap(opts HeatmapOptions) (*Heatmap, error) {
+	prefix := opts.Prefix
+	if prefix == nil {
+		prefix = s
+	}
+	bits := prefix.totalNumberOfBits()
+
+	cellBits := opts.CellBits
+	if cellBits == 0 {
+		cellBits = prefix.NetOnes + (bits-prefix.NetOnes)&^1
+		if cellBits > prefix.NetOnes+16 {
+			cellBits = prefix.NetOnes + 16
+		}
+	}
+	if cellBits < prefix.NetOnes || cellBits > bits || (cellBits-prefix.NetOnes)%2 != 0 {
+		return nil, fmt.Errorf("invalid cell bits %d for %s", cellBits, prefix.GetCidr())
+	}
+	if cellBits-prefix.NetOnes > heatmapMaxCellBits {
+		return nil, fmt.Errorf("too many cells, at most %d bits are supported", heatmapMaxCellBits)
+	}
+
+	h := &Heatmap{
+		Prefix:   prefix.CloneBase(),
+		CellBits: cellBits,
+		Side:     1 << ((cellBits - prefix.NetOnes) / 2),
+		CellSize: opts.CellSize,
+	}
+	if h.CellSize <= 0 {
+		h.CellSize = 512 / h.Side
+		if h.CellSize < 1 {
+			h.CellSize = 1
+		}
+	}
+
+	cells := 1 << (cellBits - prefix.NetOnes)
+	h.values = make([]float64, cells)
+	h.has = make([]bool, cells)
+	inside := make([]bool, cells)
+
+	var visit func(n *Subnet)
+	visit = func(n *Subnet) {
+		if n == nil || n.isIPv6 != prefix.isIPv6 || !(n.Covers(prefix) || prefix.Covers(n)) {
+			return
+		}
+
+		if !n.isDummy {
+			first, last := h.cellRange(n)
+			if opts.Value == nil {
+				if n.NetOnes > prefix.NetOnes {
+					// Only the outermost nodes count, nested ones are
+					// already covered.
+					share := 1.0
+					if n.NetOnes > cellBits {
+						share = math.Ldexp(1, -int(n.NetOnes-cellBits))
+					}
+					for i := first; i < last; i++ {
+						h.values[i] += share
+						h.has[i] = true
+					}
+					return
+				}
+			} else if v, ok := opts.Value(n); ok {
+				for i := first; i < last; i++ {
+					switch {
+					case n.NetOnes > cellBits:
+						if !inside[i] || v > h.values[i] {
+							h.values[i] = v
+						}
+						inside[i] = true
+					case !inside[i]:
+						h.values[i] = v
+					}
+					h.has[i] = true
+				}
+			}
+		}
+
+		for _, child := range n.children {
+			visit(child)
+		}
+	}
+	visit(s)
+
+	h.Min, h.Max = opts.Min, opts.Max
+	if opts.Value == nil {
+		for i := range h.values {
+			h.has[i] = h.values[i] > 0
+		}
+		if h.Min == 0 && h.Max == 0 {
+			h.Max = 1
+		}
+	} else if h.Min == 0 && h.Max == 0 {
+		first := true
+		for i, v := range h.values {
+			if !h.has[i] {
+				continue
+			}
+			if first || v < h.Min {
+				h.Min = v
+			}
+			if first || v > h.Max {
+				h.Max = v
+			}
+			first = false
+		}
+	}
+
+	if !opts.NoLabels {
+		labelBits := opts.LabelBits
+		if labelBits == 0 {
+			labelBits = prefix.NetOnes + 4
+			if labelBits > cellBits {
+				labelBits = cellBits
+			}
+		}
+		if labelBits < prefix.NetOnes || labelBits > cellBits || (labelBits-prefix.NetOnes)%2 != 0 {
+			return nil, fmt.Errorf("invalid label bits %d for %s", labelBits, prefix.GetCidr())
+		}
+
+		blocks := 1 << (labelBits - prefix.NetOnes)
+		cellsPerBlock := uint64(cells / blocks)
+		blockSide := 1 << ((cellBits - labelBits) / 2)
+		for i := 0; i < blocks; i++ {
+			x, y := hilbertXY(h.Side, uint64(i)*cellsPerBlock)
+			block := newSubnetFromInt(h.Prefix.NetInt.Add(uint128.From64(uint64(i)).Lsh(uint(bits-labelBits))), labelBits, prefix.isIPv6)
+			h.labels = append(h.labels, heatmapLabel{
+				prefix: block,
+				x:      x / blockSide * blockSide,
+				y:      y / blockSide * blockSide,
+				side:   blockSide,
+			})
+		}
+	}
+
+	return h, nil
+}
+
+// Value returns the value of the cell at x, y and whether it has one.
+func (h *Heatmap) Value(x, y int) (float64, bool) {
+	d := hilbertIndex(h.Side, x, y)
+	return h.values[d], h.has[d]
+}
+
+// CellPrefix returns the prefix of the cell at x, y.
+func (h *Heatmap) CellPrefix(x, y int) *Subnet {
+	return h.cellPrefix(hilbertIndex(h.Side, x, y))
+}
+
+func (h *Heatmap) cellPrefix(d uint64) *Subnet {
+	offset := uint128.From64(d).Lsh(uint(h.Prefix.totalNumberOfBits() - h.CellBits))
+	return newSubnetFromInt(h.Prefix.NetInt.Add(offset), h.CellBits, h.Prefix.isIPv6)
+}
+
+var (
+	heatmapBackground = color.RGBA{0xee, 0xee, 0xee, 0xff}
+	heatmapBorder     = color.RGBA{0x44, 0x44, 0x44, 0xff}
+	heatmapScale      = []color.RGBA{
+		{0x1a, 0x98, 0x50, 0xff},
+		{0xfe, 0xe0, 0x8b, 0xff},
+		{0xd7, 0x30, 0x27, 0xff},
+	}
+)
+
+// color maps a value to the green, yellow, red scale.
+func (h *Heatmap) color(v float64) color.RGBA {
+	t := 1.0
+	if h.Max > h.Min {
+		t = (v - h.Min) / (h.Max - h.Min)
+	}
+	t = math.Max(0, math.Min(1, t))
+
+	pos := t * float64(len(heatmapScale)-1)
+	i := int(pos)
+	if i >= len(heatmapScale)-1 {
+		return heatmapScale[len(heatmapScale)-1]
+	}
+
+	f := pos - float64(i)
+	a, b := heatmapScale[i], heatmapScale[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// heatmapFont is a 3x5 pixel font of the characters of addresses.
+var heatmapFont = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7}, 'a': {2, 5, 7, 5, 5}, 'b': {6, 5, 6, 5, 6},
+	'c': {7, 4, 4, 4, 7}, 'd': {6, 5, 5, 5, 6}, 'e': {7, 4, 7, 4, 7}, 'f': {7, 4, 7, 4, 4},
+	'.': {0, 0, 0, 0, 2}, ':': {0, 2, 0, 2, 0}, '/': {1, 1, 2, 4, 4},
+}
+
+// drawText draws str with the bitmap font on a white box, when it fits into
+// width.
+func drawText(img *image.RGBA, x, y, width, scale int, str string) {
+	w := (len(str)*4 + 1) * scale
+	if w > width {
+		return
+	}
+
+	draw.Draw(img, image.Rect(x, y, x+w, y+7*scale), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, c := range str {
+		glyph := heatmapFont[c]
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				if glyph[row]&(4>>uint(col)) == 0 {
+					continue
+				}
+				px := x + (1+i*4+col)*scale
+				py := y + (1+row)*scale
+				draw.Draw(img, image.Rect(px, py, px+scale, py+scale), image.NewUniform(color.Black), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// Image renders the heatmap.
+func (h *Heatmap) Image() *image.RGBA {
+	size := h.Side * h.CellSize
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(heatmapBackground), image.Point{}, draw.Src)
+
+	for d := range h.values {
+		if !h.has[d] {
+			continue
+		}
+		x, y := hilbertXY(h.Side, uint64(d))
+		rect := image.Rect(x*h.CellSize, y*h.CellSize, (x+1)*h.CellSize, (y+1)*h.CellSize)
+		draw.Draw(img, rect, image.NewUniform(h.color(h.values[d])), image.Point{}, draw.Src)
+	}
+
+	scale := 1
+	if size >= 512 {
+		scale = 2
+	}
+	for _, l := range h.labels {
+		x0, y0 := l.x*h.CellSize, l.y*h.CellSize
+		x1, y1 := x0+l.side*h.CellSize-1, y0+l.side*h.CellSize-1
+		for x := x0; x <= x1; x++ {
+			img.Set(x, y0, heatmapBorder)
+			img.Set(x, y1, heatmapBorder)
+		}
+		for y := y0; y <= y1; y++ {
+			img.Set(x0, y, heatmapBorder)
+			img.Set(x1, y, heatmapBorder)
+		}
+		drawText(img, x0+1, y0+1, x1-x0-1, scale, l.prefix.GetCidr())
+	}
+
+	return img
+}
+
+// WritePNG writes the heatmap as PNG, labels use a small bitmap font.
+func (h *Heatmap) WritePNG(w io.Writer) error {
+	return png.Encode(w, h.Image())
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// WriteSVG writes the heatmap as SVG, with a title on every cell.
+func (h *Heatmap) WriteSVG(w io.Writer) error {
+	size := h.Side * h.CellSize
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", size, size, size, size)
+	fmt.Fprintf(b, `<rect width="%d" height="%d" fill="%s"/>`+"\n", size, size, svgColor(heatmapBackground))
+
+	for d := range h.values {
+		if !h.has[d] {
+			continue
+		}
+		x, y := hilbertXY(h.Side, uint64(d))
+		cell := h.cellPrefix(uint64(d))
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%s %s</title></rect>`+"\n",
+			x*h.CellSize, y*h.CellSize, h.CellSize, h.CellSize, svgColor(h.color(h.values[d])),
+			cell.GetCidr(), strconv.FormatFloat(h.values[d], 'g', 4, 64))
+	}
+
+	fontSize := 10
+	if size >= 512 {
+		fontSize = 14
+	}
+	for _, l := range h.labels {
+		x, y, side := l.x*h.CellSize, l.y*h.CellSize, l.side*h.CellSize
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="%s"/>`+"\n", x, y, side, side, svgColor(heatmapBorder))
+		fmt.Fprintf(b, `<text x="%d" y="%d" font-family="monospace" font-size="%d">%s</text>`+"\n", x+3, y+fontSize+2, fontSize, l.prefix.GetCidr())
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
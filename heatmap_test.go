@@ -0,0 +1,144 @@
+package ipcalc
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestHilbert(t *testing.T) {
+	for _, side := range []int{1, 2, 4, 16} {
+		seen := map[[2]int]bool{}
+		px, py := 0, 0
+		for d := 0; d < side*side; d++ {
+			x, y := hilbertXY(side, uint64(d))
+			if x < 0 || y < 0 || x >= side || y >= side || seen[[2]int{x, y}] {
+				t.Fatalf("side %d: got cell %d at %d,%d, want a new cell inside", side, d, x, y)
+			}
+			seen[[2]int{x, y}] = true
+
+			if dist := abs(x-px) + abs(y-py); d > 0 && dist != 1 {
+				t.Errorf("side %d: got cell %d at %d,%d, want next to %d,%d", side, d, x, y, px, py)
+			}
+			px, py = x, y
+
+			if got := hilbertIndex(side, x, y); got != uint64(d) {
+				t.Errorf("side %d: %d,%d: got %d, want %d", side, x, y, got, d)
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func TestHeatmapAllocation(t *testing.T) {
+	table := NewTable()
+	for _, cidr := range []string{"10.0.0.0/8", "10.0.0.0/16", "10.0.0.0/20", "10.1.0.128/25", "10.255.0.0/16", "192.0.2.0/24"} {
+		table.Insert(NewSubnet(cidr))
+	}
+
+	h, err := table.ipv4.Heatmap(HeatmapOptions{Prefix: NewSubnet("10.0.0.0/8")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.CellBits != 24 || h.Side != 256 || h.CellSize != 2 {
+		t.Fatalf("got cell bits %d side %d cell size %d, want 24 256 2", h.CellBits, h.Side, h.CellSize)
+	}
+
+	var tests = []struct {
+		cell    uint64
+		want    float64
+		wantHas bool
+	}{
+		{0, 1, true},       // 10.0.0.0/24 in 10.0.0.0/16
+		{255, 1, true},     // 10.0.255.0/24
+		{256, 0.5, true},   // 10.1.0.0/24, half of it allocated
+		{257, 0, false},    // 10.1.1.0/24
+		{0xff00, 1, true},  // 10.255.0.0/24
+		{0x8000, 0, false}, // 10.128.0.0/24
+	}
+
+	for _, tt := range tests {
+		x, y := hilbertXY(h.Side, tt.cell)
+		got, has := h.Value(x, y)
+		if got != tt.want || has != tt.wantHas {
+			t.Errorf("%s: got %v %t, want %v %t", h.CellPrefix(x, y).GetCidr(), got, has, tt.want, tt.wantHas)
+		}
+	}
+
+	if len(h.labels) != 16 || h.labels[15].prefix.GetCidr() != "10.240.0.0/12" || h.labels[15].side != 64 {
+		t.Errorf("got %d labels, last %+v, want 16, last 10.240.0.0/12", len(h.labels), h.labels[15])
+	}
+
+	b := &bytes.Buffer{}
+	if err := h.WritePNG(b); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 512 || bounds.Dy() != 512 {
+		t.Errorf("got bounds %v, want 512x512", bounds)
+	}
+	if r, g, b, _ := img.At(300, 300).RGBA(); r>>8 != 0xee || g>>8 != 0xee || b>>8 != 0xee {
+		t.Errorf("got free cell color %x %x %x, want ee ee ee", r>>8, g>>8, b>>8)
+	}
+
+	b.Reset()
+	if err := h.WriteSVG(b); err != nil {
+		t.Fatal(err)
+	}
+	svg := b.String()
+	for _, want := range []string{`width="512"`, ">10.0.0.0/12</text>", ">10.240.0.0/12</text>", "<title>10.1.0.0/24 0.5</title>"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("got svg without %s", want)
+		}
+	}
+}
+
+func TestHeatmapValues(t *testing.T) {
+	table := NewTable()
+	for cidr, meta := range map[string]string{
+		"2001:db8::/32":       "10",
+		"2001:db8:1::/48":     "20",
+		"2001:db8:2::/64":     "5",
+		"2001:db8:2:0:1::/80": "30",
+		"2001:db8:3::/48":     "not a number",
+	} {
+		s := NewSubnet(cidr)
+		s.Meta = meta
+		table.Insert(s)
+	}
+
+	h, err := table.ipv6.Heatmap(HeatmapOptions{Prefix: NewSubnet("2001:db8::/32"), CellBits: 48, Value: MetaValue, NoLabels: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Min != 10 || h.Max != 30 || len(h.labels) != 0 {
+		t.Errorf("got min %v max %v and %d labels, want 10 30 0", h.Min, h.Max, len(h.labels))
+	}
+
+	for cell, want := range []float64{10, 20, 30, 10} {
+		x, y := hilbertXY(h.Side, uint64(cell))
+		if got, has := h.Value(x, y); got != want || !has {
+			t.Errorf("%s: got %v %t, want %v", h.CellPrefix(x, y).GetCidr(), got, has, want)
+		}
+	}
+
+	for _, opts := range []HeatmapOptions{
+		{Prefix: NewSubnet("2001:db8::/32"), CellBits: 49},
+		{Prefix: NewSubnet("2001:db8::/32"), CellBits: 64},
+		{Prefix: NewSubnet("2001:db8::/32"), CellBits: 40, LabelBits: 35},
+	} {
+		if _, err := table.ipv6.Heatmap(opts); err == nil {
+			t.Errorf("%d %d: got nil error, wanted failure", opts.CellBits, opts.LabelBits)
+		}
+	}
+}
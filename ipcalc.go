@@ -2,7 +2,9 @@ package ipcalc
 
 import (
 	"encoding/binary"
+	"fmt"
 	"net"
+	"sort"
 
 	"github.com/vrgakos/uint128"
 )
@@ -16,10 +18,17 @@ func ipToInt(ip net.IP) (uint128.Uint128, int) {
 		), 32
 	}
 
+	return ipToInt128(ip), 128
+}
+
+// ipToInt128 always converts to the 16 byte form, so IPv4-mapped addresses
+// keep their ::ffff: prefix.
+func ipToInt128(ip net.IP) uint128.Uint128 {
+	ip = ip.To16()
 	return uint128.New(
 		binary.BigEndian.Uint64(ip[8:]),
 		binary.BigEndian.Uint64(ip[:8]),
-	), 128
+	)
 }
 
 func intToIPv4(i uint128.Uint128) net.IP {
@@ -35,6 +44,16 @@ func intToIPv6(i uint128.Uint128) net.IP {
 	return net.IP(b)
 }
 
+// ipString formats ip like net.IP.String, but keeps the ::ffff: prefix of
+// IPv4-mapped IPv6 addresses.
+func ipString(ip net.IP, isIPv6 bool) string {
+	if isIPv6 && ip.To4() != nil {
+		return "::ffff:" + ip.String()
+	}
+
+	return ip.String()
+}
+
 func maskToInt(ones, bits int) uint128.Uint128 {
 	mask := net.CIDRMask(ones, bits)
 	if mask == nil {
@@ -57,3 +76,116 @@ func maskToInt(ones, bits int) uint128.Uint128 {
 
 	return uint128.Zero
 }
+
+func parseIPInt(ip net.IP) (uint128.Uint128, int, error) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return uint128.Zero, 0, fmt.Errorf("invalid ip address")
+	}
+
+	i, bits := ipToInt(ip)
+	return i, bits, nil
+}
+
+// AddIP returns the address n after ip, or an error when it is past the
+// end of the address family. IPv4-mapped addresses count as IPv4.
+func AddIP(ip net.IP, n uint128.Uint128) (net.IP, error) {
+	i, bits, err := parseIPInt(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if maskToInt(bits, bits).Sub(i).Cmp(n) < 0 {
+		return nil, fmt.Errorf("%s + %s overflows the address family", ip, n)
+	}
+
+	return rangeIP(i.Add(n), bits), nil
+}
+
+// SubIP returns the address n before ip, or an error when it is before the
+// start of the address family.
+func SubIP(ip net.IP, n uint128.Uint128) (net.IP, error) {
+	i, bits, err := parseIPInt(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if i.Cmp(n) < 0 {
+		return nil, fmt.Errorf("%s - %s underflows the address family", ip, n)
+	}
+
+	return rangeIP(i.Sub(n), bits), nil
+}
+
+// AddIP64 adds a signed offset to ip.
+func AddIP64(ip net.IP, n int64) (net.IP, error) {
+	if n < 0 {
+		// -n overflows for math.MinInt64, but its uint64 is still 2^63.
+		return SubIP(ip, uint128.From64(uint64(-n)))
+	}
+
+	return AddIP(ip, uint128.From64(uint64(n)))
+}
+
+// NextIP returns the address after ip.
+func NextIP(ip net.IP) (net.IP, error) {
+	return AddIP(ip, uint128.From64(1))
+}
+
+// PrevIP returns the address before ip.
+func PrevIP(ip net.IP) (net.IP, error) {
+	return SubIP(ip, uint128.From64(1))
+}
+
+// Distance returns the number of addresses from a to b, in either direction.
+func Distance(a, b net.IP) (uint128.Uint128, error) {
+	ai, aBits, err := parseIPInt(a)
+	if err != nil {
+		return uint128.Zero, err
+	}
+	bi, bBits, err := parseIPInt(b)
+	if err != nil {
+		return uint128.Zero, err
+	}
+
+	if aBits != bBits {
+		return uint128.Zero, fmt.Errorf("%s and %s are of different address families", a, b)
+	}
+
+	if ai.Cmp(bi) > 0 {
+		return ai.Sub(bi), nil
+	}
+	return bi.Sub(ai), nil
+}
+
+// CompareIP orders IPv4 addresses before IPv6 ones, then by value, like the
+// subnets of a Table. Invalid addresses come first.
+func CompareIP(a, b net.IP) int {
+	ai, aBits, aErr := parseIPInt(a)
+	bi, bBits, bErr := parseIPInt(b)
+
+	switch {
+	case aErr != nil || bErr != nil:
+		if aErr == nil {
+			return 1
+		}
+		if bErr == nil {
+			return -1
+		}
+		return 0
+	case aBits != bBits:
+		if aBits < bBits {
+			return -1
+		}
+		return 1
+	}
+
+	return ai.Cmp(bi)
+}
+
+// SortIPs sorts mixed IPv4 and IPv6 addresses in place, in the order of
+// CompareIP.
+func SortIPs(ips []net.IP) {
+	sort.SliceStable(ips, func(i, j int) bool {
+		return CompareIP(ips[i], ips[j]) < 0
+	})
+}
@@ -2,7 +2,10 @@ package ipcalc
 
 import (
 	"net"
+	"strings"
 	"testing"
+
+	"github.com/vrgakos/uint128"
 )
 
 func TestIpToInt(t *testing.T) {
@@ -42,3 +45,101 @@ func TestIpToInt(t *testing.T) {
 		})
 	}
 }
+
+func TestIPArithmetic(t *testing.T) {
+	var tests = []struct {
+		ip   string
+		n    int64
+		want string // empty for overflow
+	}{
+		{"10.0.0.255", 1, "10.0.1.0"},
+		{"10.0.1.0", -1, "10.0.0.255"},
+		{"0.0.0.0", -1, ""},
+		{"0.0.0.0", 0, "0.0.0.0"},
+		{"255.255.255.255", 1, ""},
+		{"255.255.255.254", 1, "255.255.255.255"},
+		{"0.0.0.0", 1<<32 - 1, "255.255.255.255"},
+		{"0.0.0.0", 1 << 32, ""},
+		{"::ffff:10.0.0.1", 1, "10.0.0.2"},
+		{"::", -1, ""},
+		{"::", 1, "::1"},
+		{"::ffff:ffff", 1, "::1:0:0"},
+		{"2001:db8::", -9223372036854775808, "2001:db7:ffff:ffff:8000::"},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", 1, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 1, ""},
+	}
+
+	for _, tt := range tests {
+		got, err := AddIP64(net.ParseIP(tt.ip), tt.n)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s %+d: got %s, wanted failure", tt.ip, tt.n, got)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s %+d: got %s and error %v, want %s", tt.ip, tt.n, got, err, tt.want)
+		}
+	}
+
+	if got, err := AddIP(net.ParseIP("::"), uint128.Max); err != nil || got.String() != "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff" {
+		t.Errorf("got %s and error %v, want ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", got, err)
+	}
+	if got, err := SubIP(net.ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), uint128.Max); err != nil || got.String() != "::" {
+		t.Errorf("got %s and error %v, want ::", got, err)
+	}
+	if got, err := NextIP(net.ParseIP("192.0.2.255")); err != nil || got.String() != "192.0.3.0" {
+		t.Errorf("got %s and error %v, want 192.0.3.0", got, err)
+	}
+	if got, err := PrevIP(net.ParseIP("2001:db8::")); err != nil || got.String() != "2001:db7:ffff:ffff:ffff:ffff:ffff:ffff" {
+		t.Errorf("got %s and error %v, want 2001:db7:ffff:ffff:ffff:ffff:ffff:ffff", got, err)
+	}
+	if _, err := NextIP(nil); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want string // empty for error
+	}{
+		{"10.0.0.0", "10.0.1.0", "256"},
+		{"10.0.1.0", "10.0.0.0", "256"},
+		{"0.0.0.0", "255.255.255.255", "4294967295"},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "340282366920938463463374607431768211455"},
+		{"::1", "::1", "0"},
+		{"10.0.0.0", "::a00:0", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := Distance(net.ParseIP(tt.a), net.ParseIP(tt.b))
+		if (err != nil) != (tt.want == "") || (err == nil && got.String() != tt.want) {
+			t.Errorf("%s %s: got %s and error %v, want %s", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+}
+
+func TestSortIPs(t *testing.T) {
+	ips := []net.IP{}
+	for _, ip := range []string{"2001:db8::1", "10.0.0.2", "::", "255.255.255.255", "::ffff:10.0.0.1", "0.0.0.0", "2001:db8::"} {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	ips = append(ips, nil)
+	SortIPs(ips)
+
+	got := []string{}
+	for _, ip := range ips {
+		got = append(got, ip.String())
+	}
+	if want := "<nil> 0.0.0.0 10.0.0.1 10.0.0.2 255.255.255.255 :: 2001:db8:: 2001:db8::1"; strings.Join(got, " ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, " "), want)
+	}
+
+	if got := CompareIP(net.ParseIP("10.0.0.1"), net.ParseIP("::ffff:10.0.0.1")); got != 0 {
+		t.Errorf("got %d, want 0", got)
+	}
+	if got := CompareIP(net.ParseIP("::1"), net.ParseIP("1.0.0.0")); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+}
@@ -0,0 +1,220 @@
+package ipcalc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// IPSet is a named set of addresses or subnets, like the hash:ip and
+// hash:net sets of ipset or the sets of nftables.
+type IPSet struct {
+	Name    string
+	Type    string
+	IPv6    bool
+	Options string // the rest of the set definition, kept verbatim
+
+	members *Table
+}
+
+func NewIPSet(name, setType string, isIPv6 bool) *IPSet {
+	return &IPSet{
+		Name:    name,
+		Type:    setType,
+		IPv6:    isIPv6,
+		members: NewTable(),
+	}
+}
+
+func (set *IPSet) Add(s *Subnet) error {
+	if s == nil {
+		return fmt.Errorf("invalid subnet")
+	}
+
+	if s.isIPv6 != set.IPv6 {
+		return fmt.Errorf("%s does not match the ip version of set %s", s.GetCidr(), set.Name)
+	}
+
+	_, err := set.members.Insert(s)
+	return err
+}
+
+func (set *IPSet) Contains(ip net.IP) bool {
+	_, err := set.members.LookupIP(ip)
+	return err == nil
+}
+
+// Members returns the members of the set in address order.
+func (set *IPSet) Members() []*Subnet {
+	res := []*Subnet{}
+	set.members.Walk(func(s *Subnet) bool {
+		res = append(res, s)
+		return true
+	})
+
+	return res
+}
+
+func (set *IPSet) Len() int {
+	return set.members.Len()
+}
+
+// parseAddressElement parses an address, a cidr or a "first-last" range.
+func parseAddressElement(elem string) ([]*Subnet, error) {
+	if strings.Contains(elem, "/") {
+		s := NewSubnet(elem)
+		if s == nil {
+			return nil, fmt.Errorf("could not parse cidr %q", elem)
+		}
+		return []*Subnet{s}, nil
+	}
+
+	if parts := strings.SplitN(elem, "-", 2); len(parts) == 2 {
+		first := net.ParseIP(parts[0])
+		last := net.ParseIP(parts[1])
+		if first == nil || last == nil {
+			return nil, fmt.Errorf("could not parse range %q", elem)
+		}
+
+		start, startBits := ipToInt(first)
+		end, endBits := ipToInt(last)
+		if startBits != endBits || start.Cmp(end) > 0 {
+			return nil, fmt.Errorf("invalid range %q", elem)
+		}
+		return rangeToSubnets(start, end, startBits), nil
+	}
+
+	s := newHostSubnet(net.ParseIP(elem))
+	if s == nil {
+		return nil, fmt.Errorf("could not parse address %q", elem)
+	}
+	return []*Subnet{s}, nil
+}
+
+// formatAddressElement writes hosts without their prefix length.
+func formatAddressElement(s *Subnet) string {
+	if s.IsHostAddress() {
+		return s.GetNetworkStr()
+	}
+
+	return s.GetCidr()
+}
+
+// splitFields returns the first n fields of line and the rest of it.
+func splitFields(line string, n int) ([]string, string) {
+	fields := []string{}
+	rest := strings.TrimSpace(line)
+	for len(fields) < n && rest != "" {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		fields = append(fields, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+
+	return fields, rest
+}
+
+// ReadIPSets reads the output of "ipset save". Only hash:ip and hash:net
+// sets are supported. Options of the members are kept in their Meta.
+func ReadIPSets(r io.Reader) ([]*IPSet, error) {
+	sets := []*IPSet{}
+	byName := map[string]*IPSet{}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields, rest := splitFields(line, 3)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: too few fields", lineNum)
+		}
+
+		switch fields[0] {
+		case "create":
+			if fields[2] != "hash:ip" && fields[2] != "hash:net" {
+				return nil, fmt.Errorf("line %d: unsupported set type %s", lineNum, fields[2])
+			}
+
+			set := NewIPSet(fields[1], fields[2], false)
+			options := strings.Fields(rest)
+			for i := 0; i < len(options); i++ {
+				if options[i] == "family" && i+1 < len(options) {
+					set.IPv6 = options[i+1] == "inet6"
+					options = append(options[:i], options[i+2:]...)
+					break
+				}
+			}
+			set.Options = strings.Join(options, " ")
+
+			sets = append(sets, set)
+			byName[set.Name] = set
+
+		case "add":
+			set := byName[fields[1]]
+			if set == nil {
+				return nil, fmt.Errorf("line %d: unknown set %s", lineNum, fields[1])
+			}
+
+			members, err := parseAddressElement(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+
+			for _, member := range members {
+				if set.Type == "hash:ip" && !member.IsHostAddress() {
+					return nil, fmt.Errorf("line %d: %s is not an address", lineNum, fields[2])
+				}
+				member.Meta = rest
+				if err := set.Add(member); err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNum, err)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("line %d: unsupported command %s", lineNum, fields[0])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+// WriteIPSets writes the sets in the format of "ipset save".
+func WriteIPSets(w io.Writer, sets []*IPSet) error {
+	b := &strings.Builder{}
+	for _, set := range sets {
+		family := "inet"
+		if set.IPv6 {
+			family = "inet6"
+		}
+
+		fmt.Fprintf(b, "create %s %s family %s", set.Name, set.Type, family)
+		if set.Options != "" {
+			fmt.Fprintf(b, " %s", set.Options)
+		}
+		b.WriteString("\n")
+
+		for _, member := range set.Members() {
+			fmt.Fprintf(b, "add %s %s", set.Name, formatAddressElement(member))
+			if member.Meta != "" {
+				fmt.Fprintf(b, " %s", member.Meta)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
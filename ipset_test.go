@@ -0,0 +1,80 @@
+package ipcalc
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+const ipsetSave = `create blocklist hash:net family inet hashsize 1024 maxelem 65536
+add blocklist 10.0.0.0/8
+add blocklist 192.0.2.1
+add blocklist 198.51.100.0/24 nomatch
+create admins hash:ip family inet6 hashsize 1024 maxelem 65536 timeout 600
+add admins 2001:db8::1 timeout 300
+add admins 2001:db8::2 timeout 300
+`
+
+func TestIPSetRoundTrip(t *testing.T) {
+	sets, err := ReadIPSets(strings.NewReader(ipsetSave))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sets) != 2 || sets[0].Len() != 3 || sets[1].Len() != 2 || !sets[1].IPv6 {
+		t.Fatalf("got unexpected sets %v", sets)
+	}
+
+	if !sets[0].Contains(net.ParseIP("10.1.2.3")) || sets[0].Contains(net.ParseIP("11.1.2.3")) {
+		t.Errorf("wrong membership in %s", sets[0].Name)
+	}
+
+	b := &strings.Builder{}
+	if err := WriteIPSets(b, sets); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != ipsetSave {
+		t.Errorf("got\n%s\nwant\n%s", b, ipsetSave)
+	}
+}
+
+func TestReadIPSetsRanges(t *testing.T) {
+	sets, err := ReadIPSets(strings.NewReader("create r hash:net\nadd r 10.0.0.1-10.0.0.6\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &strings.Builder{}
+	WriteIPSets(b, sets)
+	want := `create r hash:net family inet
+add r 10.0.0.1
+add r 10.0.0.2/31
+add r 10.0.0.4/31
+add r 10.0.0.6
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestReadIPSetsErrors(t *testing.T) {
+	var tests = []struct {
+		input, err string
+	}{
+		{"create p hash:net,port family inet\n", "line 1: unsupported set type hash:net,port"},
+		{"create s hash:net\nadd t 10.0.0.0/8\n", "line 2: unknown set t"},
+		{"create s hash:ip\n\nadd s 10.0.0.0/8\n", "line 3: 10.0.0.0/8 is not an address"},
+		{"create s hash:net\nadd s 2001:db8::/32\n", "line 2: 2001:db8::/32 does not match the ip version of set s"},
+		{"create s hash:net\nadd s bogus\n", `line 2: could not parse address "bogus"`},
+		{"flush s\n", "line 1: too few fields"},
+		{"destroy s now\n", "line 1: unsupported command destroy"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadIPSets(strings.NewReader(tt.input))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: got error %v, want %s", tt.input, err, tt.err)
+		}
+	}
+}
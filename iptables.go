@@ -0,0 +1,396 @@
+package ipcalc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IptablesChain is one chain of an iptables-save dump. Its rules are kept in
+// an ACL, the policy of built-in chains is the default action of the ACL.
+type IptablesChain struct {
+	Table    string
+	Name     string
+	Policy   string // ACCEPT, DROP or "-" for user defined chains
+	Counters string // "[packets:bytes]" of the chain definition
+	// ACL has the rules of the chain, the ones it can not express are its
+	// opaque rules. Evaluate ignores the opaque rules, so its result is only
+	// reliable when the chain has none.
+	ACL *ACL
+}
+
+// chainRules returns the rule lines of a chain: the ACL rules with the
+// opaque rules put back at their places.
+func chainRules(acl *ACL, format func(*Rule) string) []string {
+	res := []string{}
+	opaque := acl.Opaque()
+	next := 0
+	for i, r := range acl.Rules() {
+		for ; next < len(opaque) && opaque[next].Index <= i; next++ {
+			res = append(res, opaque[next].Text)
+		}
+		res = append(res, format(r))
+	}
+
+	for ; next < len(opaque); next++ {
+		res = append(res, opaque[next].Text)
+	}
+
+	return res
+}
+
+var iptablesProtocols = map[string]Protocol{
+	"all":       ProtocolAny,
+	"icmp":      ProtocolICMP,
+	"tcp":       ProtocolTCP,
+	"udp":       ProtocolUDP,
+	"ipv6-icmp": ProtocolICMPv6,
+	"icmpv6":    ProtocolICMPv6,
+	"sctp":      ProtocolSCTP,
+}
+
+func parseProtocol(name string) (Protocol, error) {
+	if p, ok := iptablesProtocols[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+
+	n, err := strconv.ParseUint(name, 10, 8)
+	if err != nil || n == uint64(ProtocolAny) {
+		return 0, fmt.Errorf("unsupported protocol %s", name)
+	}
+
+	return Protocol(n), nil
+}
+
+func parseAction(target string) (Action, error) {
+	switch strings.ToLower(target) {
+	case "accept":
+		return ActionAccept, nil
+	case "drop":
+		return ActionDrop, nil
+	case "reject":
+		return ActionReject, nil
+	}
+
+	return 0, fmt.Errorf("unsupported target %s", target)
+}
+
+// parsePortRange parses "port" and "first<sep>last".
+func parsePortRange(str, sep string) (*PortRange, error) {
+	parts := strings.SplitN(str, sep, 2)
+	first, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", str)
+	}
+
+	last := first
+	if len(parts) == 2 {
+		if last, err = strconv.ParseUint(parts[1], 10, 16); err != nil || last < first {
+			return nil, fmt.Errorf("invalid port range %q", str)
+		}
+	}
+
+	return &PortRange{First: uint16(first), Last: uint16(last)}, nil
+}
+
+// parseSubnetOrHost parses a cidr or a single address.
+func parseSubnetOrHost(str string) (*Subnet, error) {
+	s := NewSubnet(str)
+	if s == nil {
+		s = newHostSubnet(net.ParseIP(str))
+	}
+
+	if s == nil {
+		return nil, fmt.Errorf("could not parse address %q", str)
+	}
+
+	return s, nil
+}
+
+// splitQuoted splits line on white space, double quoted strings are kept
+// together without the quotes.
+func splitQuoted(line string) ([]string, error) {
+	res := []string{}
+	var current strings.Builder
+	inToken, inQuotes := false, false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			inQuotes = !inQuotes
+			inToken = true
+		case !inQuotes && (c == ' ' || c == '\t'):
+			if inToken {
+				res = append(res, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteByte(c)
+			inToken = true
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	if inToken {
+		res = append(res, current.String())
+	}
+
+	return res, nil
+}
+
+func policyToAction(policy string) Action {
+	if policy == "DROP" {
+		return ActionDrop
+	}
+
+	return ActionAccept
+}
+
+func parseIptablesRule(args []string) (*Rule, error) {
+	r := &Rule{Protocol: ProtocolAny}
+	hasTarget := false
+
+	for i := 0; i < len(args); i++ {
+		opt := args[i]
+		if opt == "!" {
+			return nil, fmt.Errorf("negated matches are not supported")
+		}
+
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("missing value for %s", opt)
+		}
+		i++
+		value := args[i]
+
+		var err error
+		switch opt {
+		case "-s", "--source":
+			r.Src, err = parseSubnetOrHost(value)
+		case "-d", "--destination":
+			r.Dst, err = parseSubnetOrHost(value)
+		case "-p", "--protocol":
+			r.Protocol, err = parseProtocol(value)
+		case "-m", "--match":
+			switch value {
+			case "tcp", "udp", "sctp", "comment":
+			default:
+				err = fmt.Errorf("unsupported match %s", value)
+			}
+		case "--sport", "--source-port":
+			r.SrcPorts, err = parsePortRange(value, ":")
+		case "--dport", "--destination-port":
+			r.DstPorts, err = parsePortRange(value, ":")
+		case "--comment":
+			r.Name = value
+		case "--reject-with":
+			r.rejectWith = value
+		case "-j", "--jump":
+			r.Action, err = parseAction(value)
+			hasTarget = true
+		default:
+			err = fmt.Errorf("unsupported option %s", opt)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasTarget {
+		return nil, fmt.Errorf("rule without target")
+	}
+
+	return r, nil
+}
+
+// ReadIptablesSave reads the output of iptables-save or ip6tables-save, with
+// or without the rule counters of the -c option. The ACL of a chain gets the
+// rules built from address, protocol and port matches, comments and the
+// ACCEPT, DROP and REJECT targets. Other rules are kept as opaque rules, with
+// a warning for each of them.
+func ReadIptablesSave(r io.Reader) ([]*IptablesChain, []*LineError, error) {
+	chains := []*IptablesChain{}
+	warnings := []*LineError{}
+	byName := map[string]*IptablesChain{}
+	table := ""
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// iptables-save -c puts the counters before the rule.
+		counters, ruleLine := "", line
+		if end := strings.Index(line, "] -A "); strings.HasPrefix(line, "[") && end > 0 {
+			counters, ruleLine = line[:end+1], line[end+2:]
+		}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "*"):
+			table = line[1:]
+		case line == "COMMIT":
+			table = ""
+		case strings.HasPrefix(line, ":"):
+			fields := strings.Fields(line[1:])
+			if table == "" || len(fields) < 2 {
+				return nil, nil, fmt.Errorf("line %d: invalid chain definition", lineNum)
+			}
+
+			chain := &IptablesChain{
+				Table:  table,
+				Name:   fields[0],
+				Policy: fields[1],
+				ACL:    NewACL(policyToAction(fields[1])),
+			}
+			if len(fields) > 2 {
+				chain.Counters = fields[2]
+			}
+			chains = append(chains, chain)
+			byName[table+"/"+chain.Name] = chain
+		case strings.HasPrefix(ruleLine, "-A "):
+			args, err := splitQuoted(ruleLine)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+
+			chain := byName[table+"/"+args[1]]
+			if chain == nil {
+				return nil, nil, fmt.Errorf("line %d: unknown chain %s", lineNum, args[1])
+			}
+
+			rule, err := parseIptablesRule(args[2:])
+			if err == nil {
+				rule.counters = counters
+				err = chain.ACL.Add(rule)
+			}
+			if err != nil {
+				chain.ACL.AddOpaque(line)
+				warnings = append(warnings, &LineError{Line: lineNum, Err: err})
+			}
+		default:
+			return nil, nil, fmt.Errorf("line %d: unsupported line", lineNum)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return chains, warnings, nil
+}
+
+// quoteIptables quotes str the way iptables-save does: only when it has
+// other characters than letters, digits, "-" and "_".
+func quoteIptables(str string) string {
+	plain := str != ""
+	for _, c := range str {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			plain = false
+			break
+		}
+	}
+
+	if plain {
+		return str
+	}
+
+	return strconv.Quote(str)
+}
+
+func formatIptablesRule(chain string, r *Rule) string {
+	b := &strings.Builder{}
+	if r.counters != "" {
+		fmt.Fprintf(b, "%s ", r.counters)
+	}
+	fmt.Fprintf(b, "-A %s", chain)
+	if r.Src != nil {
+		fmt.Fprintf(b, " -s %s", r.Src.GetCidr())
+	}
+	if r.Dst != nil {
+		fmt.Fprintf(b, " -d %s", r.Dst.GetCidr())
+	}
+
+	if r.Protocol != ProtocolAny {
+		proto := r.Protocol.String()
+		if r.Protocol == ProtocolICMPv6 {
+			proto = "ipv6-icmp"
+		}
+		fmt.Fprintf(b, " -p %s", proto)
+
+		if r.SrcPorts != nil || r.DstPorts != nil {
+			fmt.Fprintf(b, " -m %s", proto)
+		}
+	}
+
+	if r.SrcPorts != nil {
+		fmt.Fprintf(b, " --sport %s", strings.Replace(r.SrcPorts.String(), "-", ":", 1))
+	}
+	if r.DstPorts != nil {
+		fmt.Fprintf(b, " --dport %s", strings.Replace(r.DstPorts.String(), "-", ":", 1))
+	}
+
+	if r.Name != "" {
+		fmt.Fprintf(b, " -m comment --comment %s", quoteIptables(r.Name))
+	}
+
+	fmt.Fprintf(b, " -j %s", strings.ToUpper(r.Action.String()))
+	if r.Action == ActionReject && r.rejectWith != "" {
+		fmt.Fprintf(b, " --reject-with %s", r.rejectWith)
+	}
+	return b.String()
+}
+
+// WriteIptablesSave writes the chains in the format of iptables-save,
+// grouped by table in the order the tables first appear.
+func WriteIptablesSave(w io.Writer, chains []*IptablesChain) error {
+	tables := []string{}
+	byTable := map[string][]*IptablesChain{}
+	for _, chain := range chains {
+		if _, ok := byTable[chain.Table]; !ok {
+			tables = append(tables, chain.Table)
+		}
+		byTable[chain.Table] = append(byTable[chain.Table], chain)
+	}
+
+	b := &strings.Builder{}
+	for _, table := range tables {
+		fmt.Fprintf(b, "*%s\n", table)
+		for _, chain := range byTable[table] {
+			policy := chain.Policy
+			if policy == "" {
+				policy = strings.ToUpper(chain.ACL.Default.String())
+			}
+			counters := chain.Counters
+			if counters == "" {
+				counters = "[0:0]"
+			}
+			fmt.Fprintf(b, ":%s %s %s\n", chain.Name, policy, counters)
+		}
+
+		for _, chain := range byTable[table] {
+			format := func(r *Rule) string {
+				return formatIptablesRule(chain.Name, r)
+			}
+			for _, line := range chainRules(chain.ACL, format) {
+				fmt.Fprintf(b, "%s\n", line)
+			}
+		}
+		b.WriteString("COMMIT\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,154 @@
+package ipcalc
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/vrgakos/uint128"
+)
+
+// IterateOptions select the addresses visited by an IPIterator.
+type IterateOptions struct {
+	Reverse bool
+	// Stride is the distance of the visited addresses, 0 and 1 visit every
+	// address.
+	Stride uint128.Uint128
+	// Offset and Count select a window of the range: Count addresses from
+	// Offset, counted from the end with Reverse. Count 0 means to the end.
+	Offset uint128.Uint128
+	Count  uint128.Uint128
+	// Permutation visits the addresses in its order: the offsets selected
+	// by the other options are positions of the permutation. An interrupted
+	// iteration continues from Offset set to the next Position.
+	Permutation *Permutation
+	// Buffer holds the addresses returned by IP instead of a new net.IP for
+	// every step, it needs 4 bytes for IPv4 or 16 bytes.
+	Buffer net.IP
+}
+
+// IPIterator steps through the addresses of a range:
+//
+//	it := r.Iterate(IterateOptions{})
+//	for it.Next() {
+//		fmt.Println(it.IP())
+//	}
+type IPIterator struct {
+	r       *Range
+	perm    *Permutation
+	reverse bool
+	stride  uint128.Uint128
+	pos     uint128.Uint128 // position of the next address in the window
+	last    uint128.Uint128 // last position of the window
+	done    bool
+	buf     net.IP
+	ip      net.IP
+	offset  uint128.Uint128
+	current uint128.Uint128 // position of the current address
+}
+
+// Iterate returns an iterator over the addresses of r.
+func (r *Range) Iterate(opts IterateOptions) *IPIterator {
+	it := &IPIterator{
+		r:       r,
+		perm:    opts.Permutation,
+		reverse: opts.Reverse,
+		stride:  opts.Stride,
+		pos:     opts.Offset,
+		last:    r.Size.Last(),
+		buf:     opts.Buffer,
+	}
+	if it.stride.IsZero() {
+		it.stride = uint128.From64(1)
+	}
+
+	if r.Size.Cmp(opts.Offset) <= 0 {
+		it.done = true
+	} else if !opts.Count.IsZero() && it.last.Sub(opts.Offset).Cmp(opts.Count) >= 0 {
+		it.last = opts.Offset.Add(opts.Count.Sub64(1))
+	}
+
+	return it
+}
+
+// Iterate returns an iterator over every address of s.
+func (s *Subnet) Iterate(opts IterateOptions) *IPIterator {
+	return s.Range().Iterate(opts)
+}
+
+// IterateHosts returns an iterator over the usable host addresses of s, see
+// HostRange.
+func (s *Subnet) IterateHosts(opts IterateOptions) *IPIterator {
+	return s.HostRange().Iterate(opts)
+}
+
+// Next moves to the next address, it returns false at the end.
+func (it *IPIterator) Next() bool {
+	if it.done {
+		it.ip = nil
+		return false
+	}
+
+	it.current = it.pos
+	if it.reverse {
+		it.offset = it.r.Size.Last().Sub(it.pos)
+	} else {
+		it.offset = it.pos
+	}
+	if it.perm != nil {
+		it.offset = it.perm.Permute(it.offset)
+	}
+	it.ip = putIP(it.buf, it.r.Start.Add(it.offset), it.r.Bits)
+
+	// The position can not overflow, the window ends before.
+	if it.last.Sub(it.pos).Cmp(it.stride) < 0 {
+		it.done = true
+	} else {
+		it.pos = it.pos.Add(it.stride)
+	}
+
+	return true
+}
+
+// IP returns the current address. It is overwritten by the next step when
+// the iterator has a buffer.
+func (it *IPIterator) IP() net.IP {
+	return it.ip
+}
+
+// Offset returns the offset of the current address in the range.
+func (it *IPIterator) Offset() uint128.Uint128 {
+	return it.offset
+}
+
+// Position returns the position of the current address, counted like
+// Offset. Without a Permutation it is the offset from the start or, with
+// Reverse, from the end.
+func (it *IPIterator) Position() uint128.Uint128 {
+	return it.current
+}
+
+// putIP writes i to buf like intToIPv4 and intToIPv6, or returns a new
+// net.IP when buf is too small.
+func putIP(buf net.IP, i uint128.Uint128, bits int) net.IP {
+	if bits == 32 {
+		switch len(buf) {
+		case net.IPv4len:
+			binary.BigEndian.PutUint32(buf, uint32(i.Lo))
+			return buf
+		case net.IPv6len:
+			copy(buf, v4InV6Prefix)
+			binary.BigEndian.PutUint32(buf[12:], uint32(i.Lo))
+			return buf
+		}
+		return intToIPv4(i)
+	}
+
+	if len(buf) == net.IPv6len {
+		binary.BigEndian.PutUint64(buf[8:], i.Lo)
+		binary.BigEndian.PutUint64(buf[:8], i.Hi)
+		return buf
+	}
+	return intToIPv6(i)
+}
+
+var v4InV6Prefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
@@ -0,0 +1,99 @@
+package ipcalc
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/vrgakos/uint128"
+)
+
+func iterateString(it *IPIterator) string {
+	res := []string{}
+	for it.Next() {
+		res = append(res, it.IP().String())
+	}
+	return strings.Join(res, " ")
+}
+
+func TestIterate(t *testing.T) {
+	full6 := testRange("::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")
+	var tests = []struct {
+		r    *Range
+		opts IterateOptions
+		want string
+	}{
+		{testRange("10.0.0.254", "10.0.1.1"), IterateOptions{}, "10.0.0.254 10.0.0.255 10.0.1.0 10.0.1.1"},
+		{testRange("10.0.0.254", "10.0.1.1"), IterateOptions{Reverse: true}, "10.0.1.1 10.0.1.0 10.0.0.255 10.0.0.254"},
+		{testRange("10.0.0.0", "10.0.0.9"), IterateOptions{Stride: uint128.From64(3)}, "10.0.0.0 10.0.0.3 10.0.0.6 10.0.0.9"},
+		{testRange("10.0.0.0", "10.0.0.9"), IterateOptions{Stride: uint128.From64(4), Reverse: true}, "10.0.0.9 10.0.0.5 10.0.0.1"},
+		{testRange("10.0.0.0", "10.0.0.9"), IterateOptions{Offset: uint128.From64(2), Count: uint128.From64(3)}, "10.0.0.2 10.0.0.3 10.0.0.4"},
+		{testRange("10.0.0.0", "10.0.0.9"), IterateOptions{Offset: uint128.From64(8), Count: uint128.From64(3)}, "10.0.0.8 10.0.0.9"},
+		{testRange("10.0.0.0", "10.0.0.9"), IterateOptions{Offset: uint128.From64(1), Count: uint128.From64(2), Reverse: true}, "10.0.0.8 10.0.0.7"},
+		{testRange("10.0.0.0", "10.0.0.9"), IterateOptions{Offset: uint128.From64(10)}, ""},
+		{testRange("255.255.255.254", "255.255.255.255"), IterateOptions{}, "255.255.255.254 255.255.255.255"},
+		{testRange("0.0.0.0", "0.0.0.1"), IterateOptions{Reverse: true}, "0.0.0.1 0.0.0.0"},
+		{testRange("0.0.0.0", "0.0.0.0"), IterateOptions{}, "0.0.0.0"},
+		{full6, IterateOptions{Offset: uint128.Max.Sub64(1)}, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{full6, IterateOptions{Offset: uint128.Max.Sub64(1), Reverse: true}, "::1 ::"},
+		{full6, IterateOptions{Stride: uint128.Max}, ":: ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{full6, IterateOptions{Count: uint128.From64(2), Reverse: true}, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"},
+	}
+
+	for _, tt := range tests {
+		if got := iterateString(tt.r.Iterate(tt.opts)); got != tt.want {
+			t.Errorf("%s %+v: got %s, want %s", tt.r, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestIterateHosts(t *testing.T) {
+	var tests = []struct {
+		cidr, want string
+	}{
+		{"192.0.2.0/29", "192.0.2.1 192.0.2.2 192.0.2.3 192.0.2.4 192.0.2.5 192.0.2.6"},
+		{"192.0.2.0/31", "192.0.2.0 192.0.2.1"},
+		{"192.0.2.1/32", "192.0.2.1"},
+		{"2001:db8::/126", "2001:db8::1 2001:db8::2 2001:db8::3"},
+		{"2001:db8::/127", "2001:db8:: 2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		if got := iterateString(NewSubnet(tt.cidr).IterateHosts(IterateOptions{})); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.cidr, got, tt.want)
+		}
+	}
+
+	want := "192.0.2.3 192.0.2.2 192.0.2.1 192.0.2.0"
+	if got := iterateString(NewSubnet("192.0.2.0/30").Iterate(IterateOptions{Reverse: true})); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestIterateBuffer(t *testing.T) {
+	var tests = []struct {
+		cidr string
+		buf  net.IP
+	}{
+		{"10.0.0.0/16", make(net.IP, net.IPv4len)},
+		{"10.0.0.0/16", make(net.IP, net.IPv6len)},
+		{"2001:db8::/112", make(net.IP, net.IPv6len)},
+	}
+
+	for _, tt := range tests {
+		it := NewSubnet(tt.cidr).Iterate(IterateOptions{Buffer: tt.buf})
+		it.Next()
+		it.Next()
+		want := NewSubnet(tt.cidr).Range().GetIpByOffset64(1)
+		if got := it.IP(); &got[0] != &tt.buf[0] || !got.Equal(want) || it.Offset().Cmp64(1) != 0 {
+			t.Errorf("%s: got %s at offset %s, want %s at 1 in the buffer", tt.cidr, got, it.Offset(), want)
+		}
+
+		allocs := testing.AllocsPerRun(100, func() {
+			it.Next()
+		})
+		if allocs != 0 {
+			t.Errorf("%s: got %v allocations per step, want 0", tt.cidr, allocs)
+		}
+	}
+}
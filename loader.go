@@ -0,0 +1,354 @@
+package ipcalc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// LoadPolicy decides what happens with conflicting entries while loading:
+// duplicates and, with Loader.Overlaps, prefixes nested in each other.
+type LoadPolicy uint8
+
+const (
+	// LoadError reports conflicting entries as errors, only the first one
+	// of them is loaded.
+	LoadError LoadPolicy = iota
+	// LoadKeepFirst loads the first one of the conflicting entries.
+	LoadKeepFirst
+	// LoadKeepLast loads the last one of the conflicting entries.
+	LoadKeepLast
+	// LoadMerge loads one entry with the Meta of all of them, joined with
+	// MetaSeparator. Nested prefixes are merged into the outermost one.
+	LoadMerge
+)
+
+// LineError is an error of one line of the input.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// LoadErrors are all the errors of a load.
+type LoadErrors []*LineError
+
+func (e LoadErrors) Error() string {
+	lines := []string{}
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Loader loads prefix lists into a Table. Entries can be a cidr, a single
+// address or a "first-last" range, ranges are split into cidrs.
+//
+// Bad lines do not stop the load: the table of the good lines is returned
+// together with LoadErrors listing every bad line.
+type Loader struct {
+	Policy LoadPolicy
+	// Overlaps makes nested prefixes conflict too, not only duplicates.
+	Overlaps      bool
+	MetaSeparator string
+
+	// CSV columns, starting from 0. Columns set to -1 are not used. A
+	// range is read from RangeStart and RangeEnd when Prefix is empty.
+	Prefix     int
+	RangeStart int
+	RangeEnd   int
+	Meta       []int
+	Comma      rune
+	Header     bool // the first record is a header, even if it does not parse
+}
+
+// NewLoader returns a loader reading the prefix from the first CSV column
+// and Meta from the second one.
+func NewLoader() *Loader {
+	return &Loader{
+		Policy:        LoadError,
+		MetaSeparator: ",",
+		Prefix:        0,
+		RangeStart:    -1,
+		RangeEnd:      -1,
+		Meta:          []int{1},
+		Comma:         ',',
+	}
+}
+
+type loadEntry struct {
+	subnet *Subnet
+	line   int
+	seq    int
+}
+
+type loadState struct {
+	*Loader
+	entries []*loadEntry
+	errs    LoadErrors
+}
+
+func (l *loadState) errorf(line int, format string, a ...interface{}) {
+	l.errs = append(l.errs, &LineError{Line: line, Err: fmt.Errorf(format, a...)})
+}
+
+func (l *loadState) add(line int, subnets []*Subnet, meta string) {
+	for _, s := range subnets {
+		s.Meta = meta
+		l.entries = append(l.entries, &loadEntry{subnet: s, line: line, seq: len(l.entries)})
+	}
+}
+
+// LoadText loads a plain list with one entry per line. Everything after the
+// entry is its Meta, "#" starts a comment.
+func (l *Loader) LoadText(r io.Reader) (*Table, error) {
+	state := &loadState{Loader: l}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		fields, meta := splitFields(line, 1)
+		if len(fields) == 0 {
+			continue
+		}
+
+		subnets, err := parseAddressElement(fields[0])
+		if err != nil {
+			state.errorf(lineNum, "%v", err)
+			continue
+		}
+		state.add(lineNum, subnets, meta)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return state.build()
+}
+
+// LoadCSV loads the configured columns of CSV records.
+func (l *Loader) LoadCSV(r io.Reader) (*Table, error) {
+	state := &loadState{Loader: l}
+
+	column := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	// Records are read line by line, so errors have line numbers and a bad
+	// line does not stop the load. Quoted fields can not span lines.
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	header := l.Header
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// The header is not used, it is skipped even if it does not parse.
+		if header {
+			header = false
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.Comma = l.Comma
+		reader.TrimLeadingSpace = true
+		record, err := reader.Read()
+		if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				err = parseErr.Err
+			}
+			state.errorf(lineNum, "%v", err)
+			continue
+		}
+
+		metas := []string{}
+		for _, i := range l.Meta {
+			metas = append(metas, column(record, i))
+		}
+		meta := strings.Join(metas, l.MetaSeparator)
+
+		elem := column(record, l.Prefix)
+		if elem == "" {
+			start, end := column(record, l.RangeStart), column(record, l.RangeEnd)
+			if start == "" || end == "" {
+				state.errorf(lineNum, "missing prefix")
+				continue
+			}
+			elem = start + "-" + end
+		}
+
+		subnets, err := parseAddressElement(elem)
+		if err != nil {
+			state.errorf(lineNum, "%v", err)
+			continue
+		}
+		state.add(lineNum, subnets, meta)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return state.build()
+}
+
+func (l *loadState) mergeMeta(entries []*loadEntry) string {
+	metas := []string{}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e.subnet.Meta != "" && !seen[e.subnet.Meta] {
+			seen[e.subnet.Meta] = true
+			metas = append(metas, e.subnet.Meta)
+		}
+	}
+
+	return strings.Join(metas, l.MetaSeparator)
+}
+
+// resolve applies the policy to a group of conflicting entries, sorted by
+// their position in the input.
+func (l *loadState) resolve(group []*loadEntry, conflict string) *loadEntry {
+	switch l.Policy {
+	case LoadKeepFirst:
+		return group[0]
+	case LoadKeepLast:
+		return group[len(group)-1]
+	case LoadMerge:
+		keep := group[0]
+		keep.subnet.Meta = l.mergeMeta(group)
+		return keep
+	}
+
+	for _, e := range group[1:] {
+		l.errorf(e.line, "%s %s from line %d", e.subnet.GetCidr(), conflict, group[0].line)
+	}
+	return group[0]
+}
+
+// resolveOverlaps handles nested prefixes, in the order of the input for the
+// first and error policies and in reverse order for the last one: an entry
+// is kept when no entry kept before overlaps it.
+func (l *loadState) resolveOverlaps(entries []*loadEntry) []*loadEntry {
+	if l.Policy == LoadMerge {
+		// Entries are sorted, nested ones follow the outermost prefix.
+		res := []*loadEntry{}
+		for i := 0; i < len(entries); {
+			j := i + 1
+			for j < len(entries) && entries[i].subnet.Covers(entries[j].subnet) {
+				j++
+			}
+
+			group := append([]*loadEntry{}, entries[i:j]...)
+			sort.Slice(group, func(a, b int) bool { return group[a].seq < group[b].seq })
+			entries[i].subnet.Meta = l.mergeMeta(group)
+			res = append(res, entries[i])
+			i = j
+		}
+		return res
+	}
+
+	ordered := append([]*loadEntry{}, entries...)
+	sort.Slice(ordered, func(a, b int) bool {
+		if l.Policy == LoadKeepLast {
+			return ordered[a].seq > ordered[b].seq
+		}
+		return ordered[a].seq < ordered[b].seq
+	})
+
+	kept := NewTable()
+	owner := map[*Subnet]*loadEntry{}
+	res := []*loadEntry{}
+	for _, e := range ordered {
+		root, s := kept.route(e.subnet)
+		var other *Subnet
+		if covering := root.Covering(s); len(covering) > 0 {
+			other = covering[0]
+		} else {
+			other = root.firstCovered(s)
+		}
+
+		switch {
+		case other == nil:
+			// A /0 takes the place of the dummy root, so the owner is keyed
+			// by the node found in the tree.
+			node, err := kept.insertOrFind(e.subnet)
+			if err != nil {
+				l.errorf(e.line, "%v", err)
+				continue
+			}
+			owner[node] = e
+			res = append(res, e)
+		case l.Policy != LoadError:
+		case owner[other] == nil:
+			l.errorf(e.line, "%s overlaps %s", e.subnet.GetCidr(), other.GetCidr())
+		default:
+			l.errorf(e.line, "%s overlaps %s from line %d", e.subnet.GetCidr(), other.GetCidr(), owner[other].line)
+		}
+	}
+
+	sort.Slice(res, func(a, b int) bool { return lessSubnet(res[a].subnet, res[b].subnet) })
+	return res
+}
+
+func (l *loadState) build() (*Table, error) {
+	sort.SliceStable(l.entries, func(i, j int) bool {
+		return lessSubnet(l.entries[i].subnet, l.entries[j].subnet)
+	})
+
+	// Duplicates are next to each other, in the order of the input.
+	unique := []*loadEntry{}
+	for i := 0; i < len(l.entries); {
+		j := i + 1
+		for j < len(l.entries) && l.entries[j].subnet.SameSubnet(l.entries[i].subnet) {
+			j++
+		}
+
+		if j-i == 1 {
+			unique = append(unique, l.entries[i])
+		} else {
+			unique = append(unique, l.resolve(l.entries[i:j], "duplicates"))
+		}
+		i = j
+	}
+
+	if l.Overlaps {
+		unique = l.resolveOverlaps(unique)
+	}
+
+	subnets := make([]*Subnet, 0, len(unique))
+	for _, e := range unique {
+		subnets = append(subnets, e.subnet)
+	}
+
+	t, err := BuildTable(subnets)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(l.errs) > 0 {
+		sort.SliceStable(l.errs, func(i, j int) bool { return l.errs[i].Line < l.errs[j].Line })
+		return t, l.errs
+	}
+
+	return t, nil
+}
@@ -0,0 +1,177 @@
+package ipcalc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func tableEntries(table *Table) string {
+	entries := []string{}
+	table.Walk(func(s *Subnet) bool {
+		entries = append(entries, s.GetCidr()+"="+s.Meta)
+		return true
+	})
+
+	return strings.Join(entries, " ")
+}
+
+func TestLoadText(t *testing.T) {
+	input := `# inventory
+10.0.0.0/8      corp network
+10.1.0.0/16     lab   # comment
+192.0.2.1
+192.0.2.8-192.0.2.11 printers
+
+2001:db8::/32 v6
+not-a-prefix
+10.0.0.0/33
+`
+
+	table, err := NewLoader().LoadText(strings.NewReader(input))
+	errs, ok := err.(LoadErrors)
+	if !ok || len(errs) != 2 || errs[0].Line != 8 || errs[1].Line != 9 {
+		t.Fatalf("got errors %v, want lines 8 and 9", err)
+	}
+
+	want := "10.0.0.0/8=corp network 10.1.0.0/16=lab 192.0.2.1/32= 192.0.2.8/30=printers 2001:db8::/32=v6"
+	if got := tableEntries(table); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	input := `prefix;start;end;owner;site
+10.0.0.0/8;;;corp;hq
+;192.0.2.0;192.0.2.255;"docs; examples";lab
+;192.0.2.0;;broken;lab
+2001:db8::/32;;;v6;"hq"
+"unterminated;;;x;y
+`
+
+	l := NewLoader()
+	l.Comma = ';'
+	l.Header = true
+	l.RangeStart = 1
+	l.RangeEnd = 2
+	l.Meta = []int{3, 4}
+	l.MetaSeparator = "/"
+
+	table, err := l.LoadCSV(strings.NewReader(input))
+	errs, ok := err.(LoadErrors)
+	if !ok || len(errs) != 2 || errs[0].Line != 4 || errs[1].Line != 6 {
+		t.Fatalf("got errors %v, want lines 4 and 6", err)
+	}
+
+	want := "10.0.0.0/8=corp/hq 192.0.2.0/24=docs; examples/lab 2001:db8::/32=v6/hq"
+	if got := tableEntries(table); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestLoadCSVBadHeader(t *testing.T) {
+	input := `"prefix,owner
+10.0.0.0/8,corp
+192.0.2.0/24,docs
+`
+
+	l := NewLoader()
+	l.Header = true
+
+	table, err := l.LoadCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "10.0.0.0/8=corp 192.0.2.0/24=docs"
+	if got := tableEntries(table); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestLoadPolicies(t *testing.T) {
+	input := `10.0.0.0/24 a
+10.0.0.0/16 b
+10.0.0.0/24 c
+10.0.1.0/24 d
+10.0.0.0/8 e
+192.0.2.0/24 f
+`
+
+	var tests = []struct {
+		policy       LoadPolicy
+		overlaps     bool
+		want         string
+		wantErrLines []int
+	}{
+		{LoadError, false, "10.0.0.0/8=e 10.0.0.0/16=b 10.0.0.0/24=a 10.0.1.0/24=d 192.0.2.0/24=f", []int{3}},
+		{LoadKeepFirst, false, "10.0.0.0/8=e 10.0.0.0/16=b 10.0.0.0/24=a 10.0.1.0/24=d 192.0.2.0/24=f", nil},
+		{LoadKeepLast, false, "10.0.0.0/8=e 10.0.0.0/16=b 10.0.0.0/24=c 10.0.1.0/24=d 192.0.2.0/24=f", nil},
+		{LoadMerge, false, "10.0.0.0/8=e 10.0.0.0/16=b 10.0.0.0/24=a,c 10.0.1.0/24=d 192.0.2.0/24=f", nil},
+		{LoadError, true, "10.0.0.0/24=a 10.0.1.0/24=d 192.0.2.0/24=f", []int{2, 3, 5}},
+		{LoadKeepFirst, true, "10.0.0.0/24=a 10.0.1.0/24=d 192.0.2.0/24=f", nil},
+		{LoadKeepLast, true, "10.0.0.0/8=e 192.0.2.0/24=f", nil},
+		{LoadMerge, true, "10.0.0.0/8=a,c,b,d,e 192.0.2.0/24=f", nil},
+	}
+
+	for _, tt := range tests {
+		l := NewLoader()
+		l.Policy = tt.policy
+		l.Overlaps = tt.overlaps
+
+		table, err := l.LoadText(strings.NewReader(input))
+		lines := []int{}
+		if errs, ok := err.(LoadErrors); ok {
+			for _, e := range errs {
+				lines = append(lines, e.Line)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := tableEntries(table); got != tt.want {
+			t.Errorf("policy %d overlaps %t: got %s, want %s", tt.policy, tt.overlaps, got, tt.want)
+		}
+		if fmt.Sprint(lines) != fmt.Sprint(tt.wantErrLines) {
+			t.Errorf("policy %d overlaps %t: got error lines %v, want %v (%v)", tt.policy, tt.overlaps, lines, tt.wantErrLines, err)
+		}
+	}
+}
+
+func TestLoadPoliciesDefaultRoute(t *testing.T) {
+	input := "0.0.0.0/0 a\n10.0.0.0/8 b\n192.0.2.0/24 c\n"
+
+	var tests = []struct {
+		policy       LoadPolicy
+		want         string
+		wantErrLines []int
+	}{
+		{LoadError, "0.0.0.0/0=a", []int{2, 3}},
+		{LoadKeepFirst, "0.0.0.0/0=a", nil},
+		{LoadKeepLast, "10.0.0.0/8=b 192.0.2.0/24=c", nil},
+		{LoadMerge, "0.0.0.0/0=a,b,c", nil},
+	}
+
+	for _, tt := range tests {
+		l := NewLoader()
+		l.Policy = tt.policy
+		l.Overlaps = true
+
+		table, err := l.LoadText(strings.NewReader(input))
+		lines := []int{}
+		if errs, ok := err.(LoadErrors); ok {
+			for _, e := range errs {
+				lines = append(lines, e.Line)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := tableEntries(table); got != tt.want {
+			t.Errorf("policy %d: got %s, want %s", tt.policy, got, tt.want)
+		}
+		if fmt.Sprint(lines) != fmt.Sprint(tt.wantErrLines) {
+			t.Errorf("policy %d: got error lines %v, want %v (%v)", tt.policy, lines, tt.wantErrLines, err)
+		}
+	}
+}
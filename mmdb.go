@@ -0,0 +1,859 @@
+package ipcalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/vrgakos/uint128"
+)
+
+// MaxMind DB format, see https://maxmind.github.io/MaxMind-DB/
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEnd       = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+
+	mmdbDataSeparator   = 16
+	mmdbMaxDepth        = 64
+	mmdbMetadataMaxSize = 128 * 1024
+)
+
+type MMDBMetadata struct {
+	NodeCount                uint32
+	RecordSize               uint16
+	IPVersion                uint16
+	DatabaseType             string
+	Languages                []string
+	BinaryFormatMajorVersion uint16
+	BinaryFormatMinorVersion uint16
+	BuildEpoch               uint64
+	Description              map[string]string
+}
+
+// MMDB is a MaxMind DB held in a prefix table. Data of the records are
+// decoded into map[string]interface{}, []interface{}, string, []byte,
+// float64, float32, uint16, uint32, uint64, uint128.Uint128, int32 and bool
+// values, the same types can be written.
+//
+// IPv6 databases keep IPv4 prefixes under ::/96, like the MaxMind databases.
+// They are read as and written from IPv4 prefixes.
+type MMDB struct {
+	Metadata MMDBMetadata
+
+	table *Table
+	data  map[*Subnet]interface{}
+}
+
+func NewMMDB(databaseType string, ipVersion uint16) *MMDB {
+	return &MMDB{
+		Metadata: MMDBMetadata{
+			IPVersion:                ipVersion,
+			DatabaseType:             databaseType,
+			Languages:                []string{},
+			BinaryFormatMajorVersion: 2,
+			Description:              map[string]string{},
+		},
+		table: NewTable(),
+		data:  map[*Subnet]interface{}{},
+	}
+}
+
+// Insert sets the data of a prefix, replacing the data of prefixes already
+// in the database.
+func (db *MMDB) Insert(s *Subnet, data interface{}) error {
+	if s == nil {
+		return fmt.Errorf("invalid subnet")
+	}
+
+	if s.isIPv6 && db.Metadata.IPVersion != 6 {
+		return fmt.Errorf("%s does not fit into an IPv4 database", s.GetCidr())
+	}
+
+	node, err := db.table.insertOrFind(s)
+	if err != nil {
+		return err
+	}
+	db.data[node] = data
+
+	return nil
+}
+
+func (db *MMDB) Len() int {
+	return db.table.Len()
+}
+
+// Lookup returns the most specific prefix covering ip and its data.
+func (db *MMDB) Lookup(ip net.IP) (*Subnet, interface{}, error) {
+	node, err := db.table.LookupIP(ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return node, db.data[node], nil
+}
+
+// Walk calls fn for every prefix in address order, IPv4 ones first.
+func (db *MMDB) Walk(fn func(*Subnet, interface{}) bool) bool {
+	return db.table.Walk(func(node *Subnet) bool {
+		return fn(node, db.data[node])
+	})
+}
+
+// mmdbDecoder decodes values of the data section.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d *mmdbDecoder) control(offset int) (int, int, int, error) {
+	if offset >= len(d.buf) {
+		return 0, 0, 0, fmt.Errorf("offset %d is out of the data section", offset)
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	typ := int(ctrl >> 5)
+	if typ == mmdbPointer {
+		return typ, int(ctrl & 0x1f), offset, nil
+	}
+
+	if typ == mmdbExtended {
+		if offset >= len(d.buf) {
+			return 0, 0, 0, fmt.Errorf("truncated extended type")
+		}
+		typ = int(d.buf[offset]) + 7
+		offset++
+		if typ < mmdbInt32 {
+			return 0, 0, 0, fmt.Errorf("invalid extended type %d", typ)
+		}
+	}
+
+	size := int(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > len(d.buf) {
+			return 0, 0, 0, fmt.Errorf("truncated size")
+		}
+
+		extra := 0
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | int(b)
+		}
+		offset += n
+
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		case 3:
+			size = 65821 + extra
+		}
+	}
+
+	return typ, size, offset, nil
+}
+
+func (d *mmdbDecoder) uint(offset, size, max int) (uint64, error) {
+	if size > max {
+		return 0, fmt.Errorf("invalid integer size %d", size)
+	}
+	if offset+size > len(d.buf) {
+		return 0, fmt.Errorf("truncated integer")
+	}
+
+	v := uint64(0)
+	for _, b := range d.buf[offset : offset+size] {
+		v = v<<8 | uint64(b)
+	}
+
+	return v, nil
+}
+
+// decode returns the value at offset and the offset after it.
+func (d *mmdbDecoder) decode(offset, depth int) (interface{}, int, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("data is nested too deep")
+	}
+
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == mmdbPointer {
+		n := (size>>3)&3 + 1
+		if offset+n > len(d.buf) {
+			return nil, 0, fmt.Errorf("truncated pointer")
+		}
+
+		p := size & 7
+		if n == 4 {
+			p = 0
+		}
+		for _, b := range d.buf[offset : offset+n] {
+			p = p<<8 | int(b)
+		}
+		switch n {
+		case 2:
+			p += 2048
+		case 3:
+			p += 526336
+		}
+
+		if typ, _, _, err := d.control(p); err != nil || typ == mmdbPointer {
+			return nil, 0, fmt.Errorf("invalid pointer to %d", p)
+		}
+
+		v, _, err := d.decode(p, depth+1)
+		return v, offset + n, err
+	}
+
+	end := offset + size
+	if (typ == mmdbMap || typ == mmdbArray) && size > len(d.buf)-offset {
+		return nil, 0, fmt.Errorf("container of %d items is larger than the data", size)
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			var key, value interface{}
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			str, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[str] = value
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case mmdbBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid boolean size %d", size)
+		}
+		return size == 1, offset, nil
+	case mmdbEnd, mmdbContainer:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+
+	if end > len(d.buf) {
+		return nil, 0, fmt.Errorf("truncated value of type %d", typ)
+	}
+
+	var v interface{}
+	switch typ {
+	case mmdbString:
+		v = string(d.buf[offset:end])
+	case mmdbBytes:
+		v = append([]byte{}, d.buf[offset:end]...)
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		v = math.Float64frombits(binary.BigEndian.Uint64(d.buf[offset:]))
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		v = math.Float32frombits(binary.BigEndian.Uint32(d.buf[offset:]))
+	case mmdbUint16:
+		var n uint64
+		n, err = d.uint(offset, size, 2)
+		v = uint16(n)
+	case mmdbUint32:
+		var n uint64
+		n, err = d.uint(offset, size, 4)
+		v = uint32(n)
+	case mmdbInt32:
+		var n uint64
+		n, err = d.uint(offset, size, 4)
+		v = int32(uint32(n))
+	case mmdbUint64:
+		v, err = d.uint(offset, size, 8)
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		b := make([]byte, 16)
+		copy(b[16-size:], d.buf[offset:end])
+		v = uint128.New(binary.BigEndian.Uint64(b[8:]), binary.BigEndian.Uint64(b[:8]))
+	}
+
+	return v, end, err
+}
+
+func mmdbUintField(m map[string]interface{}, key string, max uint64) (uint64, error) {
+	var v uint64
+	switch n := m[key].(type) {
+	case uint16:
+		v = uint64(n)
+	case uint32:
+		v = uint64(n)
+	case uint64:
+		v = n
+	default:
+		return 0, fmt.Errorf("invalid metadata %s", key)
+	}
+
+	if v > max {
+		return 0, fmt.Errorf("invalid metadata %s", key)
+	}
+
+	return v, nil
+}
+
+func parseMMDBMetadata(v interface{}) (MMDBMetadata, error) {
+	meta := MMDBMetadata{Description: map[string]string{}}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return meta, fmt.Errorf("metadata is not a map")
+	}
+
+	for _, field := range []struct {
+		key string
+		max uint64
+		set func(uint64)
+	}{
+		{"node_count", math.MaxUint32, func(v uint64) { meta.NodeCount = uint32(v) }},
+		{"record_size", math.MaxUint16, func(v uint64) { meta.RecordSize = uint16(v) }},
+		{"ip_version", math.MaxUint16, func(v uint64) { meta.IPVersion = uint16(v) }},
+		{"binary_format_major_version", math.MaxUint16, func(v uint64) { meta.BinaryFormatMajorVersion = uint16(v) }},
+		{"binary_format_minor_version", math.MaxUint16, func(v uint64) { meta.BinaryFormatMinorVersion = uint16(v) }},
+		{"build_epoch", math.MaxUint64, func(v uint64) { meta.BuildEpoch = v }},
+	} {
+		n, err := mmdbUintField(m, field.key, field.max)
+		if err != nil {
+			return meta, err
+		}
+		field.set(n)
+	}
+
+	meta.DatabaseType, _ = m["database_type"].(string)
+	languages, _ := m["languages"].([]interface{})
+	for _, l := range languages {
+		if str, ok := l.(string); ok {
+			meta.Languages = append(meta.Languages, str)
+		}
+	}
+	description, _ := m["description"].(map[string]interface{})
+	for k, d := range description {
+		if str, ok := d.(string); ok {
+			meta.Description[k] = str
+		}
+	}
+
+	if meta.BinaryFormatMajorVersion != 2 {
+		return meta, fmt.Errorf("unsupported binary format version %d", meta.BinaryFormatMajorVersion)
+	}
+	if meta.RecordSize != 24 && meta.RecordSize != 28 && meta.RecordSize != 32 {
+		return meta, fmt.Errorf("unsupported record size %d", meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return meta, fmt.Errorf("unsupported ip version %d", meta.IPVersion)
+	}
+
+	return meta, nil
+}
+
+func readMMDBRecord(tree []byte, recordSize, node, bit int) uint32 {
+	b := tree[node*recordSize/4:]
+	switch recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	}
+
+	return binary.BigEndian.Uint32(b[bit*4:])
+}
+
+// ReadMMDB reads a MaxMind DB file. Every data record becomes a prefix, so
+// prefixes split by more specific ones come back as their remaining parts.
+// Aliased subtrees, like ::ffff:0:0/96 in IPv6 databases, are only read once,
+// at their lowest address.
+func ReadMMDB(r io.Reader) (*MMDB, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	start := len(buf) - mmdbMetadataMaxSize
+	if start < 0 {
+		start = 0
+	}
+	idx := bytes.LastIndex(buf[start:], mmdbMetadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("metadata not found")
+	}
+	metaStart := start + idx + len(mmdbMetadataMarker)
+
+	metaValue, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %v", err)
+	}
+	meta, err := parseMMDBMetadata(metaValue)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeCount := int(meta.NodeCount)
+	recordSize := int(meta.RecordSize)
+	treeSize := nodeCount * recordSize / 4
+	if treeSize+mmdbDataSeparator > start+idx {
+		return nil, fmt.Errorf("search tree is larger than the file")
+	}
+	tree := buf[:treeSize]
+	decoder := &mmdbDecoder{buf: buf[treeSize+mmdbDataSeparator : start+idx]}
+
+	db := NewMMDB(meta.DatabaseType, meta.IPVersion)
+	db.Metadata = meta
+
+	bits := 32
+	if meta.IPVersion == 6 {
+		bits = 128
+	}
+
+	type step struct {
+		node  int
+		path  uint128.Uint128
+		depth int
+	}
+	visited := make([]bool, nodeCount)
+	values := map[int]interface{}{}
+	stack := []step{{0, uint128.Zero, 0}}
+	if nodeCount == 0 {
+		stack = nil
+	}
+
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[cur.node] {
+			continue
+		}
+		visited[cur.node] = true
+
+		// Push the right record first, so the left one is read first.
+		for bit := 1; bit >= 0; bit-- {
+			record := int(readMMDBRecord(tree, recordSize, cur.node, bit))
+			path := cur.path
+			if bit == 1 {
+				path = path.SetBit(uint8(bits - 1 - cur.depth))
+			}
+
+			switch {
+			case record < nodeCount:
+				if cur.depth+1 >= bits {
+					return nil, fmt.Errorf("search tree is deeper than %d bits", bits)
+				}
+				stack = append(stack, step{record, path, cur.depth + 1})
+			case record > nodeCount:
+				offset := record - nodeCount - mmdbDataSeparator
+				value, ok := values[offset]
+				if !ok {
+					if value, _, err = decoder.decode(offset, 0); err != nil {
+						return nil, fmt.Errorf("data of record %d/%d: %v", cur.node, bit, err)
+					}
+					values[offset] = value
+				}
+
+				if err := db.Insert(mmdbPrefix(path, cur.depth+1, bits), value); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return db, nil
+}
+
+// mmdbPrefix converts a path of the search tree to a prefix.
+func mmdbPrefix(path uint128.Uint128, ones, bits int) *Subnet {
+	if bits == 128 && ones >= 96 && path.Hi == 0 && path.Lo>>32 == 0 {
+		return newSubnetFromInt(path, uint8(ones-96), false)
+	}
+
+	return newSubnetFromInt(path, uint8(ones), bits == 128)
+}
+
+// mmdbEncoder writes the data section, storing every distinct value once.
+type mmdbEncoder struct {
+	buf     bytes.Buffer
+	offsets map[string]int
+}
+
+func (e *mmdbEncoder) control(b *bytes.Buffer, typ, size int) error {
+	first := byte(typ << 5)
+	if typ > 7 {
+		first = 0
+	}
+
+	var extra []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		first |= 30
+		extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+	case size < 65821+1<<24:
+		first |= 31
+		size -= 65821
+		extra = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+	default:
+		return fmt.Errorf("value of type %d is too large", typ)
+	}
+
+	b.WriteByte(first)
+	if typ > 7 {
+		b.WriteByte(byte(typ - 7))
+	}
+	b.Write(extra)
+
+	return nil
+}
+
+func (e *mmdbEncoder) uint(b *bytes.Buffer, typ int, v uint64, size int) error {
+	for size > 0 && v>>(8*(size-1)) == 0 {
+		size--
+	}
+
+	if err := e.control(b, typ, size); err != nil {
+		return err
+	}
+	for i := size - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+
+	return nil
+}
+
+func (e *mmdbEncoder) encode(b *bytes.Buffer, v interface{}) error {
+	var err error
+	switch v := v.(type) {
+	case string:
+		if err = e.control(b, mmdbString, len(v)); err == nil {
+			b.WriteString(v)
+		}
+	case []byte:
+		if err = e.control(b, mmdbBytes, len(v)); err == nil {
+			b.Write(v)
+		}
+	case float64:
+		e.control(b, mmdbDouble, 8)
+		binary.Write(b, binary.BigEndian, math.Float64bits(v))
+	case float32:
+		e.control(b, mmdbFloat, 4)
+		binary.Write(b, binary.BigEndian, math.Float32bits(v))
+	case uint16:
+		err = e.uint(b, mmdbUint16, uint64(v), 2)
+	case uint32:
+		err = e.uint(b, mmdbUint32, uint64(v), 4)
+	case uint64:
+		err = e.uint(b, mmdbUint64, v, 8)
+	case int32:
+		// Negative values need all 4 bytes for their sign.
+		if v < 0 {
+			e.control(b, mmdbInt32, 4)
+			binary.Write(b, binary.BigEndian, v)
+		} else {
+			err = e.uint(b, mmdbInt32, uint64(v), 4)
+		}
+	case uint128.Uint128:
+		raw := make([]byte, 16)
+		binary.BigEndian.PutUint64(raw, v.Hi)
+		binary.BigEndian.PutUint64(raw[8:], v.Lo)
+		raw = bytes.TrimLeft(raw, "\x00")
+		if err = e.control(b, mmdbUint128, len(raw)); err == nil {
+			b.Write(raw)
+		}
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		err = e.control(b, mmdbBool, size)
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		err = e.encode(b, m)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		if err = e.control(b, mmdbMap, len(v)); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err = e.encode(b, k); err != nil {
+				return err
+			}
+			if err = e.encode(b, v[k]); err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+		}
+	case []string:
+		a := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			a = append(a, s)
+		}
+		err = e.encode(b, a)
+	case []interface{}:
+		if err = e.control(b, mmdbArray, len(v)); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err = e.encode(b, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported data type %T", v)
+	}
+
+	return err
+}
+
+// add returns the offset of v in the data section.
+func (e *mmdbEncoder) add(v interface{}) (int, error) {
+	b := &bytes.Buffer{}
+	if err := e.encode(b, v); err != nil {
+		return 0, err
+	}
+
+	if offset, ok := e.offsets[b.String()]; ok {
+		return offset, nil
+	}
+
+	offset := e.buf.Len()
+	e.offsets[b.String()] = offset
+	e.buf.Write(b.Bytes())
+	return offset, nil
+}
+
+// mmdbNode is a node of the search tree while writing. A record is either
+// empty (nil, nil), a node or a data offset.
+type mmdbNode struct {
+	id       int
+	children [2]*mmdbNode
+	data     [2]*int
+}
+
+// fill sets every empty record below n to data.
+func (n *mmdbNode) fill(data *int) {
+	for bit := 0; bit < 2; bit++ {
+		switch {
+		case n.children[bit] != nil:
+			n.children[bit].fill(data)
+		case n.data[bit] == nil:
+			n.data[bit] = data
+		}
+	}
+}
+
+// WriteMMDB writes db as a MaxMind DB file. The smallest record size fitting
+// the database is used, BuildEpoch is set to the current time when it is 0.
+func WriteMMDB(w io.Writer, db *MMDB) error {
+	bits := 32
+	if db.Metadata.IPVersion == 6 {
+		bits = 128
+	} else if db.Metadata.IPVersion != 4 {
+		return fmt.Errorf("unsupported ip version %d", db.Metadata.IPVersion)
+	}
+
+	encoder := &mmdbEncoder{offsets: map[string]int{}}
+	root := &mmdbNode{}
+	var err error
+
+	// Walk visits the parents first, so more specific prefixes split the
+	// records of the less specific ones.
+	db.Walk(func(s *Subnet, value interface{}) bool {
+		var offset int
+		if offset, err = encoder.add(value); err != nil {
+			err = fmt.Errorf("%s: %v", s.GetCidr(), err)
+			return false
+		}
+
+		// IPv4 prefixes of IPv6 databases are under ::/96.
+		ones := int(s.NetOnes)
+		if !s.isIPv6 && bits == 128 {
+			ones += 96
+		}
+		if ones == 0 {
+			err = fmt.Errorf("%s can not be stored, the search tree has no root record", s.GetCidr())
+			return false
+		}
+
+		node := root
+		for depth := 0; depth < ones; depth++ {
+			bit := 0
+			if s.NetInt.GetBit(uint8(bits - 1 - depth)) {
+				bit = 1
+			}
+
+			if depth == ones-1 {
+				if node.children[bit] != nil {
+					node.children[bit].fill(&offset)
+				} else {
+					node.data[bit] = &offset
+				}
+				break
+			}
+
+			if node.children[bit] == nil {
+				node.children[bit] = &mmdbNode{}
+				if data := node.data[bit]; data != nil {
+					node.children[bit].data = [2]*int{data, data}
+					node.data[bit] = nil
+				}
+			}
+			node = node.children[bit]
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	nodes := []*mmdbNode{}
+	stack := []*mmdbNode{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for bit := 1; bit >= 0; bit-- {
+			if n.children[bit] != nil {
+				stack = append(stack, n.children[bit])
+			}
+		}
+	}
+
+	nodeCount := len(nodes)
+	maxRecord := uint64(nodeCount) + mmdbDataSeparator + uint64(encoder.buf.Len())
+	recordSize := 24
+	switch {
+	case maxRecord < 1<<24:
+	case maxRecord < 1<<28:
+		recordSize = 28
+	case maxRecord < 1<<32:
+		recordSize = 32
+	default:
+		return fmt.Errorf("database is too large")
+	}
+
+	tree := make([]byte, nodeCount*recordSize/4)
+	for _, n := range nodes {
+		records := [2]uint32{}
+		for bit := 0; bit < 2; bit++ {
+			switch {
+			case n.children[bit] != nil:
+				records[bit] = uint32(n.children[bit].id)
+			case n.data[bit] != nil:
+				records[bit] = uint32(nodeCount + mmdbDataSeparator + *n.data[bit])
+			default:
+				records[bit] = uint32(nodeCount)
+			}
+		}
+
+		b := tree[n.id*recordSize/4:]
+		switch recordSize {
+		case 24:
+			b[0], b[1], b[2] = byte(records[0]>>16), byte(records[0]>>8), byte(records[0])
+			b[3], b[4], b[5] = byte(records[1]>>16), byte(records[1]>>8), byte(records[1])
+		case 28:
+			b[0], b[1], b[2] = byte(records[0]>>16), byte(records[0]>>8), byte(records[0])
+			b[3] = byte(records[0]>>24)<<4 | byte(records[1]>>24)
+			b[4], b[5], b[6] = byte(records[1]>>16), byte(records[1]>>8), byte(records[1])
+		case 32:
+			binary.BigEndian.PutUint32(b, records[0])
+			binary.BigEndian.PutUint32(b[4:], records[1])
+		}
+	}
+
+	meta := db.Metadata
+	if meta.BuildEpoch == 0 {
+		meta.BuildEpoch = uint64(time.Now().Unix())
+	}
+	languages := meta.Languages
+	if languages == nil {
+		languages = []string{}
+	}
+	description := meta.Description
+	if description == nil {
+		description = map[string]string{}
+	}
+
+	metaBuf := &bytes.Buffer{}
+	if err := encoder.encode(metaBuf, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  meta.IPVersion,
+		"database_type":               meta.DatabaseType,
+		"languages":                   languages,
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 meta.BuildEpoch,
+		"description":                 description,
+	}); err != nil {
+		return err
+	}
+
+	out := &bytes.Buffer{}
+	out.Write(tree)
+	out.Write(make([]byte, mmdbDataSeparator))
+	out.Write(encoder.buf.Bytes())
+	out.Write(mmdbMetadataMarker)
+	out.Write(metaBuf.Bytes())
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
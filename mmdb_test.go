@@ -0,0 +1,217 @@
+package ipcalc
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vrgakos/uint128"
+)
+
+func TestMMDBRoundTrip(t *testing.T) {
+	db := NewMMDB("Test-ASN", 6)
+	db.Metadata.Languages = []string{"en"}
+	db.Metadata.Description["en"] = "test database"
+	db.Metadata.BuildEpoch = 1700000000
+
+	records := map[string]interface{}{
+		"10.0.0.0/8":    map[string]interface{}{"owner": "corp", "asn": uint32(64500)},
+		"10.1.0.0/16":   map[string]interface{}{"owner": "lab", "asn": uint32(64501), "tags": []interface{}{"a", "b"}},
+		"10.1.2.128/25": map[string]interface{}{"owner": "lab", "asn": uint32(64501), "tags": []interface{}{"a", "b"}},
+		"192.0.2.1/32":  "host",
+		"2001:db8::/32": map[string]interface{}{
+			"owner":    "v6",
+			"float":    float32(1.5),
+			"double":   -2.25,
+			"int":      int32(-5),
+			"small":    int32(7),
+			"big":      uint64(1) << 40,
+			"huge":     uint128.New(1, 1),
+			"u16":      uint16(300),
+			"bytes":    []byte{0, 1, 2},
+			"enabled":  true,
+			"disabled": false,
+			"long":     strings.Repeat("x", 70000),
+		},
+		"2001:db8:1::/48": map[string]interface{}{},
+	}
+	for cidr, data := range records {
+		if err := db.Insert(NewSubnet(cidr), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := &bytes.Buffer{}
+	if err := WriteMMDB(b, db); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ReadMMDB(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Metadata.DatabaseType != "Test-ASN" || res.Metadata.IPVersion != 6 || res.Metadata.BuildEpoch != 1700000000 ||
+		res.Metadata.RecordSize != 24 || !reflect.DeepEqual(res.Metadata.Languages, []string{"en"}) ||
+		res.Metadata.Description["en"] != "test database" {
+		t.Errorf("got metadata %+v", res.Metadata)
+	}
+
+	// More specific prefixes split the records of the less specific ones,
+	// only the most specific prefixes are read back unchanged.
+	found := map[string]interface{}{}
+	res.Walk(func(s *Subnet, data interface{}) bool {
+		found[s.GetCidr()] = data
+		return true
+	})
+	for _, cidr := range []string{"10.1.2.128/25", "192.0.2.1/32", "2001:db8:1::/48"} {
+		if !reflect.DeepEqual(found[cidr], records[cidr]) {
+			t.Errorf("%s: got %v, want %v", cidr, found[cidr], records[cidr])
+		}
+	}
+	if s, data, _ := res.Lookup(net.ParseIP("2001:db8:8000::")); s.GetCidr() != "2001:db8:8000::/33" || !reflect.DeepEqual(data, records["2001:db8::/32"]) {
+		t.Errorf("got %s %v, want 2001:db8:8000::/33 with the 2001:db8::/32 data", s.GetCidr(), data)
+	}
+
+	var tests = []struct {
+		ip, want string
+	}{
+		{"10.200.0.1", "corp"},
+		{"10.1.200.1", "lab"},
+		{"10.1.2.200", "lab"},
+		{"2001:db8:ffff::1", "v6"},
+	}
+
+	for _, tt := range tests {
+		_, got, err := res.Lookup(net.ParseIP(tt.ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.(map[string]interface{})["owner"] != tt.want {
+			t.Errorf("%s: got %v, want owner %s", tt.ip, got, tt.want)
+		}
+	}
+
+	if s, got, err := res.Lookup(net.ParseIP("192.0.2.1")); err != nil || got != "host" || s.GetCidr() != "192.0.2.1/32" {
+		t.Errorf("got %v %v and error %v, want 192.0.2.1/32 host", s, got, err)
+	}
+
+	if _, _, err := res.Lookup(net.ParseIP("192.0.2.2")); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestMMDBRecordSizes(t *testing.T) {
+	var tests = []struct {
+		size int
+		want uint16
+	}{
+		{10, 24},
+		{1 << 24, 28},
+	}
+
+	for _, tt := range tests {
+		db := NewMMDB("Test", 4)
+		if err := db.Insert(NewSubnet("10.0.0.0/8"), strings.Repeat("x", tt.size)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(NewSubnet("192.0.2.0/24"), "small"); err != nil {
+			t.Fatal(err)
+		}
+
+		b := &bytes.Buffer{}
+		if err := WriteMMDB(b, db); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := ReadMMDB(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Metadata.RecordSize; got != tt.want {
+			t.Errorf("got record size %d, want %d", got, tt.want)
+		}
+		if _, got, _ := res.Lookup(net.ParseIP("192.0.2.1")); got != "small" {
+			t.Errorf("got %v, want small", got)
+		}
+	}
+}
+
+func TestMMDBRecords(t *testing.T) {
+	// Two nodes of each record size, the values follow the spec examples.
+	node28 := []byte{0x12, 0x34, 0x56, 0xab, 0x78, 0x9a, 0xbc}
+	if l, r := readMMDBRecord(append(make([]byte, 7), node28...), 28, 1, 0), readMMDBRecord(append(make([]byte, 7), node28...), 28, 1, 1); l != 0xa123456 || r != 0xb789abc {
+		t.Errorf("got 28 bit records %x %x, want a123456 b789abc", l, r)
+	}
+
+	node24 := []byte{0, 0, 0, 0, 0, 0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc}
+	if l, r := readMMDBRecord(node24, 24, 1, 0), readMMDBRecord(node24, 24, 1, 1); l != 0x123456 || r != 0x789abc {
+		t.Errorf("got 24 bit records %x %x, want 123456 789abc", l, r)
+	}
+
+	node32 := []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	if l, r := readMMDBRecord(node32, 32, 0, 0), readMMDBRecord(node32, 32, 0, 1); l != 0x12345678 || r != 0x9abcdef0 {
+		t.Errorf("got 32 bit records %x %x, want 12345678 9abcdef0", l, r)
+	}
+}
+
+func TestMMDBDecodePointers(t *testing.T) {
+	// {<pointer to "abc">: <pointer to {"k": "v"}>, "def": "ghi"}
+	data := []byte{
+		0x43, 'a', 'b', 'c', // 0: "abc"
+		0xe1, 0x41, 'k', 0x41, 'v', // 4: {"k": "v"}
+		0xe2,       // 9: map of 2
+		0x20, 0x00, // pointer to "abc" as key
+		0x20, 0x04, // pointer to {"k": "v"}
+		0x43, 'd', 'e', 'f', // "def"
+		0x43, 'g', 'h', 'i', // "ghi"
+	}
+
+	got, end, err := (&mmdbDecoder{buf: data}).decode(9, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"abc": map[string]interface{}{"k": "v"},
+		"def": "ghi",
+	}
+	if !reflect.DeepEqual(got, want) || end != len(data) {
+		t.Errorf("got %v ending at %d, want %v ending at %d", got, end, want, len(data))
+	}
+
+	for _, bad := range [][]byte{
+		{0x20, 0x02, 0x20, 0x00}, // pointer to pointer
+		{0x20, 0x10},             // pointer out of the data
+		{0x44, 'a', 'b'},         // truncated string
+		{0xe3, 0x41, 'k'},        // map larger than the data
+		{0xa3, 0x01, 0x02, 0x03}, // uint16 of size 3
+		{0x0f, 0x0e, 0x00},       // boolean of size 15
+		{0x61, 0x00},             // double of size 1
+		{0x01, 0x00, 0x00},       // extended type 7
+	} {
+		if v, _, err := (&mmdbDecoder{buf: bad}).decode(0, 0); err == nil {
+			t.Errorf("%x: got %v, wanted failure", bad, v)
+		}
+	}
+}
+
+func TestMMDBErrors(t *testing.T) {
+	db := NewMMDB("Test", 4)
+	if err := db.Insert(NewSubnet("2001:db8::/32"), "x"); err == nil {
+		t.Errorf("got nil error for an ipv6 prefix, wanted failure")
+	}
+
+	if err := db.Insert(NewSubnet("10.0.0.0/8"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMMDB(&bytes.Buffer{}, db); err == nil {
+		t.Errorf("got nil error for int data, wanted failure")
+	}
+
+	if _, err := ReadMMDB(strings.NewReader("not a database")); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
@@ -0,0 +1,478 @@
+package ipcalc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vrgakos/uint128"
+)
+
+const (
+	mrtTableDumpV2 = 13
+
+	mrtPeerIndexTable   = 1
+	mrtRIBIPv4Unicast   = 2
+	mrtRIBIPv6Unicast   = 4
+	mrtPeerTypeIPv6     = 0x01
+	mrtPeerTypeAS4      = 0x02
+	bgpAttrExtendedLen  = 0x10
+	bgpAttrOrigin       = 1
+	bgpAttrASPath       = 2
+	bgpAttrNextHop      = 3
+	bgpAttrMED          = 4
+	bgpAttrLocalPref    = 5
+	bgpAttrCommunities  = 8
+	bgpAttrMPReachNLRI  = 14
+	mrtMaxRecordLength  = 1 << 24
+	mrtRecordHeaderSize = 12
+)
+
+type BGPPeer struct {
+	BGPID net.IP
+	IP    net.IP
+	AS    uint32
+}
+
+type BGPOrigin uint8
+
+const (
+	OriginIGP BGPOrigin = iota
+	OriginEGP
+	OriginIncomplete
+)
+
+func (o BGPOrigin) String() string {
+	switch o {
+	case OriginIGP:
+		return "IGP"
+	case OriginEGP:
+		return "EGP"
+	case OriginIncomplete:
+		return "INCOMPLETE"
+	}
+
+	return fmt.Sprintf("Origin(%d)", uint8(o))
+}
+
+const (
+	ASSet      = 1
+	ASSequence = 2
+)
+
+type ASPathSegment struct {
+	Type uint8
+	ASNs []uint32
+}
+
+type ASPath []ASPathSegment
+
+func (p ASPath) String() string {
+	parts := []string{}
+	for _, seg := range p {
+		asns := []string{}
+		for _, asn := range seg.ASNs {
+			asns = append(asns, strconv.FormatUint(uint64(asn), 10))
+		}
+
+		if seg.Type == ASSet {
+			parts = append(parts, "{"+strings.Join(asns, ",")+"}")
+		} else {
+			parts = append(parts, asns...)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// OriginAS returns the last AS of the path. Paths ending in an AS_SET have
+// no single origin, unless the set has only one member.
+func (p ASPath) OriginAS() (uint32, bool) {
+	if len(p) == 0 {
+		return 0, false
+	}
+
+	last := p[len(p)-1]
+	if len(last.ASNs) == 0 || (last.Type == ASSet && len(last.ASNs) != 1) {
+		return 0, false
+	}
+
+	return last.ASNs[len(last.ASNs)-1], true
+}
+
+// RIBEntry is the route of one peer for a prefix.
+type RIBEntry struct {
+	Peer        *BGPPeer
+	Originated  time.Time
+	Origin      BGPOrigin
+	ASPath      ASPath
+	NextHop     net.IP
+	MED         uint32
+	LocalPref   uint32
+	Communities []uint32
+}
+
+// RIB holds the routes of all peers for a prefix.
+type RIB struct {
+	Prefix   *Subnet
+	Sequence uint32
+	Entries  []*RIBEntry
+}
+
+// OriginASNs returns the distinct origin ASes of the entries, in the order
+// they were seen.
+func (rib *RIB) OriginASNs() []uint32 {
+	res := []uint32{}
+	seen := map[uint32]bool{}
+	for _, e := range rib.Entries {
+		if asn, ok := e.ASPath.OriginAS(); ok && !seen[asn] {
+			seen[asn] = true
+			res = append(res, asn)
+		}
+	}
+
+	return res
+}
+
+// MRTReader streams the RIB records of an MRT TABLE_DUMP_V2 file (RFC 6396).
+// Records of other types and subtypes are skipped.
+type MRTReader struct {
+	Collector net.IP
+	ViewName  string
+	Peers     []*BGPPeer
+
+	r       *bufio.Reader
+	records int
+}
+
+func NewMRTReader(r io.Reader) *MRTReader {
+	return &MRTReader{r: bufio.NewReader(r)}
+}
+
+// mrtData is a bounds checked reader of a record body.
+type mrtData struct {
+	buf []byte
+	err error
+}
+
+func (d *mrtData) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.buf) {
+		d.err = fmt.Errorf("truncated record")
+		return nil
+	}
+
+	res := d.buf[:n]
+	d.buf = d.buf[n:]
+	return res
+}
+
+func (d *mrtData) uint8() uint8 {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *mrtData) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *mrtData) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *mrtData) ip(n int) net.IP {
+	if b := d.bytes(n); b != nil {
+		return net.IP(append([]byte{}, b...))
+	}
+	return nil
+}
+
+// Next returns the next RIB record, or io.EOF at the end of the file.
+func (m *MRTReader) Next() (*RIB, error) {
+	for {
+		header := make([]byte, mrtRecordHeaderSize)
+		if _, err := io.ReadFull(m.r, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("record %d: truncated header", m.records)
+			}
+			return nil, err
+		}
+
+		recordType := binary.BigEndian.Uint16(header[4:])
+		subtype := binary.BigEndian.Uint16(header[6:])
+		length := binary.BigEndian.Uint32(header[8:])
+		if length > mrtMaxRecordLength {
+			return nil, fmt.Errorf("record %d: length %d is too large", m.records, length)
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(m.r, body); err != nil {
+			return nil, fmt.Errorf("record %d: truncated body", m.records)
+		}
+		m.records++
+
+		if recordType != mrtTableDumpV2 {
+			continue
+		}
+
+		d := &mrtData{buf: body}
+		switch subtype {
+		case mrtPeerIndexTable:
+			if err := m.readPeerIndex(d); err != nil {
+				return nil, fmt.Errorf("record %d: %v", m.records-1, err)
+			}
+		case mrtRIBIPv4Unicast, mrtRIBIPv6Unicast:
+			rib, err := m.readRIB(d, subtype == mrtRIBIPv6Unicast)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %v", m.records-1, err)
+			}
+			return rib, nil
+		}
+	}
+}
+
+func (m *MRTReader) readPeerIndex(d *mrtData) error {
+	m.Collector = d.ip(4)
+	m.ViewName = string(d.bytes(int(d.uint16())))
+
+	count := int(d.uint16())
+	m.Peers = make([]*BGPPeer, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		peerType := d.uint8()
+		peer := &BGPPeer{BGPID: d.ip(4)}
+
+		if peerType&mrtPeerTypeIPv6 != 0 {
+			peer.IP = d.ip(16)
+		} else {
+			peer.IP = d.ip(4)
+		}
+
+		if peerType&mrtPeerTypeAS4 != 0 {
+			peer.AS = d.uint32()
+		} else {
+			peer.AS = uint32(d.uint16())
+		}
+
+		m.Peers = append(m.Peers, peer)
+	}
+
+	return d.err
+}
+
+func (m *MRTReader) readRIB(d *mrtData, isIPv6 bool) (*RIB, error) {
+	rib := &RIB{Sequence: d.uint32()}
+
+	size := 4
+	if isIPv6 {
+		size = 16
+	}
+
+	ones := int(d.uint8())
+	if ones > size*8 {
+		return nil, fmt.Errorf("invalid prefix length %d", ones)
+	}
+	prefix := make(net.IP, size)
+	copy(prefix, d.bytes((ones+7)/8))
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var netInt uint128.Uint128
+	if isIPv6 {
+		netInt = ipToInt128(prefix)
+	} else {
+		netInt, _ = ipToInt(prefix)
+	}
+	rib.Prefix = newSubnetFromInt(netInt, uint8(ones), isIPv6)
+	if !rib.Prefix.NetInt.Equals(netInt) {
+		return nil, fmt.Errorf("invalid prefix %s/%d", prefix, ones)
+	}
+
+	count := int(d.uint16())
+	for i := 0; i < count && d.err == nil; i++ {
+		peerIndex := int(d.uint16())
+		if d.err == nil && peerIndex >= len(m.Peers) {
+			return nil, fmt.Errorf("unknown peer %d", peerIndex)
+		}
+
+		e := &RIBEntry{Originated: time.Unix(int64(d.uint32()), 0).UTC()}
+		attrs := d.bytes(int(d.uint16()))
+		if d.err != nil {
+			break
+		}
+		e.Peer = m.Peers[peerIndex]
+
+		if err := readBGPAttributes(e, attrs); err != nil {
+			return nil, fmt.Errorf("%s: %v", rib.Prefix.GetCidr(), err)
+		}
+		rib.Entries = append(rib.Entries, e)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return rib, nil
+}
+
+// readBGPAttributes reads the path attributes of an entry. AS numbers are
+// always 4 bytes and MP_REACH_NLRI only has its next hop in TABLE_DUMP_V2.
+// Unknown attributes are skipped.
+func readBGPAttributes(e *RIBEntry, attrs []byte) error {
+	d := &mrtData{buf: attrs}
+	for len(d.buf) > 0 && d.err == nil {
+		flags := d.uint8()
+		attrType := d.uint8()
+
+		length := 0
+		if flags&bgpAttrExtendedLen != 0 {
+			length = int(d.uint16())
+		} else {
+			length = int(d.uint8())
+		}
+
+		value := &mrtData{buf: d.bytes(length)}
+		if d.err != nil {
+			break
+		}
+
+		switch attrType {
+		case bgpAttrOrigin:
+			e.Origin = BGPOrigin(value.uint8())
+		case bgpAttrASPath:
+			for len(value.buf) > 0 && value.err == nil {
+				seg := ASPathSegment{Type: value.uint8()}
+				count := int(value.uint8())
+				for i := 0; i < count && value.err == nil; i++ {
+					seg.ASNs = append(seg.ASNs, value.uint32())
+				}
+				e.ASPath = append(e.ASPath, seg)
+			}
+		case bgpAttrNextHop:
+			e.NextHop = value.ip(4)
+		case bgpAttrMED:
+			e.MED = value.uint32()
+		case bgpAttrLocalPref:
+			e.LocalPref = value.uint32()
+		case bgpAttrCommunities:
+			for len(value.buf) > 0 && value.err == nil {
+				e.Communities = append(e.Communities, value.uint32())
+			}
+		case bgpAttrMPReachNLRI:
+			// Only the first (global) address of the next hop is used.
+			if n := int(value.uint8()); n >= 16 {
+				e.NextHop = value.ip(16)
+			} else {
+				e.NextHop = value.ip(n)
+			}
+		}
+
+		if value.err != nil {
+			return fmt.Errorf("attribute %d: %v", attrType, value.err)
+		}
+	}
+
+	return d.err
+}
+
+// BGPTable is a trie of the prefixes of a RIB dump. The Meta of every prefix
+// is its origin ASes, like "AS64500" or "AS64500 AS64501" for MOAS prefixes.
+type BGPTable struct {
+	table *Table
+	ribs  map[*Subnet]*RIB
+}
+
+func NewBGPTable() *BGPTable {
+	return &BGPTable{
+		table: NewTable(),
+		ribs:  map[*Subnet]*RIB{},
+	}
+}
+
+// Add adds a RIB record. Entries of a prefix that is already in the table
+// are appended to it.
+func (t *BGPTable) Add(rib *RIB) error {
+	node, err := t.table.insertOrFind(rib.Prefix)
+	if err != nil {
+		return err
+	}
+
+	if existing := t.ribs[node]; existing != nil {
+		existing.Entries = append(existing.Entries, rib.Entries...)
+	} else {
+		t.ribs[node] = &RIB{Prefix: node, Sequence: rib.Sequence, Entries: rib.Entries}
+	}
+
+	origins := []string{}
+	for _, asn := range t.ribs[node].OriginASNs() {
+		origins = append(origins, fmt.Sprintf("AS%d", asn))
+	}
+	node.Meta = strings.Join(origins, " ")
+
+	return nil
+}
+
+// ReadMRT reads all RIB records of an MRT TABLE_DUMP_V2 file into a table.
+func ReadMRT(r io.Reader) (*BGPTable, error) {
+	t := NewBGPTable()
+	m := NewMRTReader(r)
+	for {
+		rib, err := m.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := t.Add(rib); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *BGPTable) Len() int {
+	return t.table.Len()
+}
+
+// Lookup returns the RIB of the most specific prefix covering ip.
+func (t *BGPTable) Lookup(ip net.IP) (*RIB, error) {
+	node, err := t.table.LookupIP(ip)
+	if err != nil {
+		return nil, fmt.Errorf("no prefix covers %s", ip)
+	}
+
+	return t.ribs[node], nil
+}
+
+// OriginAS returns the origin ASes of the most specific prefix covering ip.
+func (t *BGPTable) OriginAS(ip net.IP) ([]uint32, error) {
+	rib, err := t.Lookup(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return rib.OriginASNs(), nil
+}
+
+// Walk calls fn for every RIB in prefix order.
+func (t *BGPTable) Walk(fn func(*RIB) bool) bool {
+	return t.table.Walk(func(node *Subnet) bool {
+		return fn(t.ribs[node])
+	})
+}
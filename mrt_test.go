@@ -0,0 +1,234 @@
+package ipcalc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+type mrtBuilder struct {
+	bytes.Buffer
+}
+
+func (b *mrtBuilder) u8(v uint8) *mrtBuilder {
+	b.WriteByte(v)
+	return b
+}
+
+func (b *mrtBuilder) u16(v uint16) *mrtBuilder {
+	binary.Write(b, binary.BigEndian, v)
+	return b
+}
+
+func (b *mrtBuilder) u32(v uint32) *mrtBuilder {
+	binary.Write(b, binary.BigEndian, v)
+	return b
+}
+
+func (b *mrtBuilder) raw(v []byte) *mrtBuilder {
+	b.Write(v)
+	return b
+}
+
+func (b *mrtBuilder) record(recordType, subtype uint16, body []byte) *mrtBuilder {
+	return b.u32(1600000000).u16(recordType).u16(subtype).u32(uint32(len(body))).raw(body)
+}
+
+func mrtAttr(attrType uint8, value []byte) []byte {
+	return append([]byte{0x40, attrType, uint8(len(value))}, value...)
+}
+
+func mrtASPath(asns ...uint32) []byte {
+	b := &mrtBuilder{}
+	b.u8(ASSequence).u8(uint8(len(asns)))
+	for _, asn := range asns {
+		b.u32(asn)
+	}
+	return mrtAttr(bgpAttrASPath, b.Bytes())
+}
+
+func mrtEntry(peer uint16, attrs ...[]byte) []byte {
+	all := bytes.Join(attrs, nil)
+	b := &mrtBuilder{}
+	return b.u16(peer).u32(1500000000).u16(uint16(len(all))).raw(all).Bytes()
+}
+
+func mrtRIB(seq uint32, prefix []byte, ones uint8, entries ...[]byte) []byte {
+	b := &mrtBuilder{}
+	b.u32(seq).u8(ones).raw(prefix).u16(uint16(len(entries)))
+	for _, e := range entries {
+		b.raw(e)
+	}
+	return b.Bytes()
+}
+
+func testMRTDump() []byte {
+	peers := &mrtBuilder{}
+	peers.raw([]byte{192, 0, 2, 1}).u16(4).raw([]byte("test")).u16(2)
+	peers.u8(mrtPeerTypeAS4).raw([]byte{10, 0, 0, 1}).raw([]byte{192, 0, 2, 10}).u32(4200000000)
+	peers.u8(mrtPeerTypeIPv6).raw([]byte{10, 0, 0, 2}).raw(net.ParseIP("2001:db8::10")).u16(64502)
+
+	mpReach := append([]byte{16}, net.ParseIP("2001:db8::10")...)
+
+	b := &mrtBuilder{}
+	// A BGP4MP record, which is skipped.
+	b.record(16, 4, []byte{1, 2, 3, 4})
+	b.record(mrtTableDumpV2, mrtPeerIndexTable, peers.Bytes())
+	b.record(mrtTableDumpV2, mrtRIBIPv4Unicast, mrtRIB(0, []byte{10}, 8,
+		mrtEntry(0, mrtAttr(bgpAttrOrigin, []byte{0}), mrtASPath(4200000000, 64500), mrtAttr(bgpAttrNextHop, []byte{192, 0, 2, 10}), mrtAttr(bgpAttrCommunities, []byte{0xfd, 0xe8, 0, 1})),
+		mrtEntry(1, mrtAttr(bgpAttrOrigin, []byte{2}), mrtASPath(64502, 64501, 64500)),
+	))
+	b.record(mrtTableDumpV2, mrtRIBIPv4Unicast, mrtRIB(1, []byte{10, 20}, 15,
+		mrtEntry(0, mrtASPath(4200000000, 64510)),
+		mrtEntry(1, mrtASPath(64502, 64511)),
+	))
+	b.record(mrtTableDumpV2, mrtRIBIPv6Unicast, mrtRIB(2, []byte{0x20, 0x01, 0x0d, 0xb8}, 32,
+		mrtEntry(1, mrtASPath(64502, 64520), mrtAttr(bgpAttrMPReachNLRI, mpReach)),
+	))
+
+	return b.Bytes()
+}
+
+func TestMRTReader(t *testing.T) {
+	m := NewMRTReader(bytes.NewReader(testMRTDump()))
+
+	rib, err := m.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.ViewName != "test" || m.Collector.String() != "192.0.2.1" || len(m.Peers) != 2 {
+		t.Fatalf("got peer index %s %s with %d peers, want test 192.0.2.1 with 2", m.ViewName, m.Collector, len(m.Peers))
+	}
+	if m.Peers[0].AS != 4200000000 || m.Peers[1].AS != 64502 || m.Peers[1].IP.String() != "2001:db8::10" {
+		t.Errorf("got peers %+v %+v", m.Peers[0], m.Peers[1])
+	}
+
+	if rib.Prefix.GetCidr() != "10.0.0.0/8" || len(rib.Entries) != 2 {
+		t.Fatalf("got %s with %d entries, want 10.0.0.0/8 with 2", rib.Prefix.GetCidr(), len(rib.Entries))
+	}
+
+	e := rib.Entries[0]
+	if e.Peer != m.Peers[0] || e.Origin != OriginIGP || e.ASPath.String() != "4200000000 64500" ||
+		e.NextHop.String() != "192.0.2.10" || !reflect.DeepEqual(e.Communities, []uint32{65000<<16 | 1}) ||
+		e.Originated.Unix() != 1500000000 {
+		t.Errorf("got entry %+v", e)
+	}
+	if got := rib.Entries[1].Origin; got != OriginIncomplete {
+		t.Errorf("got origin %s, want %s", got, OriginIncomplete)
+	}
+	if got := rib.OriginASNs(); !reflect.DeepEqual(got, []uint32{64500}) {
+		t.Errorf("got origin ASNs %v, want [64500]", got)
+	}
+
+	if rib, err = m.Next(); err != nil || rib.Prefix.GetCidr() != "10.20.0.0/15" {
+		t.Fatalf("got %v and error %v, want 10.20.0.0/15", rib, err)
+	}
+
+	if rib, err = m.Next(); err != nil || rib.Prefix.GetCidr() != "2001:db8::/32" {
+		t.Fatalf("got %v and error %v, want 2001:db8::/32", rib, err)
+	}
+	if got := rib.Entries[0].NextHop.String(); got != "2001:db8::10" {
+		t.Errorf("got next hop %s, want 2001:db8::10", got)
+	}
+
+	if _, err = m.Next(); err != io.EOF {
+		t.Errorf("got error %v, want EOF", err)
+	}
+}
+
+func TestReadMRTOriginAS(t *testing.T) {
+	table, err := ReadMRT(bytes.NewReader(testMRTDump()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := table.Len(); got != 3 {
+		t.Errorf("got %d prefixes, want 3", got)
+	}
+
+	var tests = []struct {
+		ip   string
+		want []uint32
+	}{
+		{"10.1.2.3", []uint32{64500}},
+		{"10.21.0.1", []uint32{64510, 64511}},
+		{"2001:db8::1", []uint32{64520}},
+	}
+
+	for _, tt := range tests {
+		got, err := table.OriginAS(net.ParseIP(tt.ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if _, err := table.OriginAS(net.ParseIP("192.168.0.1")); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+
+	rib, _ := table.Lookup(net.ParseIP("10.21.0.1"))
+	if got := rib.Prefix.Meta; got != "AS64510 AS64511" {
+		t.Errorf("got meta %q, want %q", got, "AS64510 AS64511")
+	}
+}
+
+func TestASPathOriginAS(t *testing.T) {
+	var tests = []struct {
+		path   ASPath
+		want   uint32
+		wantOk bool
+	}{
+		{ASPath{}, 0, false},
+		{ASPath{{ASSequence, []uint32{1, 2, 3}}}, 3, true},
+		{ASPath{{ASSequence, []uint32{1, 2}}, {ASSet, []uint32{3, 4}}}, 0, false},
+		{ASPath{{ASSequence, []uint32{1, 2}}, {ASSet, []uint32{5}}}, 5, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.path.OriginAS()
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("%s: got %d %t, want %d %t", tt.path, got, ok, tt.want, tt.wantOk)
+		}
+	}
+
+	path := ASPath{{ASSequence, []uint32{1, 2}}, {ASSet, []uint32{3, 4}}}
+	if got := path.String(); got != "1 2 {3,4}" {
+		t.Errorf("got %s, want 1 2 {3,4}", got)
+	}
+}
+
+func TestMRTReaderErrors(t *testing.T) {
+	dump := testMRTDump()
+
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", dump[:5]},
+		{"truncated body", dump[:len(dump)-3]},
+		{"rib before peer index", (&mrtBuilder{}).record(mrtTableDumpV2, mrtRIBIPv4Unicast, mrtRIB(0, []byte{10}, 8, mrtEntry(0))).Bytes()},
+		{"host bits", (&mrtBuilder{}).record(mrtTableDumpV2, mrtRIBIPv4Unicast, mrtRIB(0, []byte{10, 1}, 8)).Bytes()},
+		{"prefix length", (&mrtBuilder{}).record(mrtTableDumpV2, mrtRIBIPv4Unicast, mrtRIB(0, []byte{10, 1, 2, 3, 4}, 33)).Bytes()},
+		{"truncated attribute", (&mrtBuilder{}).
+			record(mrtTableDumpV2, mrtPeerIndexTable, (&mrtBuilder{}).u32(0).u16(0).u16(1).u8(0).u32(0).u32(0).u16(1).Bytes()).
+			record(mrtTableDumpV2, mrtRIBIPv4Unicast, mrtRIB(0, []byte{10}, 8, mrtEntry(0, []byte{0x40, bgpAttrMED, 4, 0}))).Bytes()},
+	}
+
+	for _, tt := range tests {
+		m := NewMRTReader(bytes.NewReader(tt.data))
+		var err error
+		for err == nil {
+			_, err = m.Next()
+		}
+		if err == io.EOF {
+			t.Errorf("%s: got EOF, wanted failure", tt.name)
+		}
+	}
+}
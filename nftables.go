@@ -0,0 +1,332 @@
+package ipcalc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type NftTable struct {
+	Family string
+	Name   string
+	Sets   []*IPSet
+	Chains []*NftChain
+}
+
+type NftChain struct {
+	Name   string
+	Hook   string // "type filter hook input priority filter;" of base chains
+	Policy string
+	// ACL has the rules of the chain, the ones it can not express are its
+	// opaque rules. Evaluate ignores the opaque rules, so its result is only
+	// reliable when the chain has none.
+	ACL *ACL
+}
+
+func parseNftRule(args []string) (*Rule, error) {
+	r := &Rule{Protocol: ProtocolAny}
+	hasVerdict := false
+
+	next := func(i int) (string, error) {
+		if i >= len(args) {
+			return "", fmt.Errorf("missing value after %s", args[i-1])
+		}
+		if args[i] == "!=" {
+			return "", fmt.Errorf("negated matches are not supported")
+		}
+		if strings.HasPrefix(args[i], "@") || args[i] == "{" {
+			return "", fmt.Errorf("set references are not supported")
+		}
+		return args[i], nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		var err error
+		var value string
+
+		switch args[i] {
+		case "ip", "ip6", "tcp", "udp", "sctp", "meta":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value after %s", args[i])
+			}
+			key := args[i] + " " + args[i+1]
+			if value, err = next(i + 2); err != nil {
+				return nil, err
+			}
+			i += 2
+
+			switch key {
+			case "ip saddr", "ip6 saddr":
+				r.Src, err = parseSubnetOrHost(value)
+			case "ip daddr", "ip6 daddr":
+				r.Dst, err = parseSubnetOrHost(value)
+			case "ip protocol", "ip6 nexthdr", "meta l4proto":
+				r.Protocol, err = parseProtocol(value)
+			case "tcp sport", "udp sport", "sctp sport":
+				r.Protocol, _ = parseProtocol(args[i-2])
+				r.SrcPorts, err = parsePortRange(value, "-")
+			case "tcp dport", "udp dport", "sctp dport":
+				r.Protocol, _ = parseProtocol(args[i-2])
+				r.DstPorts, err = parsePortRange(value, "-")
+			default:
+				err = fmt.Errorf("unsupported match %s", key)
+			}
+		case "comment":
+			if value, err = next(i + 1); err == nil {
+				r.Name = value
+				i++
+			}
+		case "accept", "drop", "reject":
+			r.Action, err = parseAction(args[i])
+			hasVerdict = true
+		default:
+			err = fmt.Errorf("unsupported statement %s", args[i])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !hasVerdict {
+		return nil, fmt.Errorf("rule without verdict")
+	}
+
+	return r, nil
+}
+
+func parseNftElements(set *IPSet, elements string) error {
+	elements = strings.TrimSpace(elements)
+	if !strings.HasPrefix(elements, "{") || !strings.HasSuffix(elements, "}") {
+		return fmt.Errorf("invalid elements %q", elements)
+	}
+
+	for _, elem := range strings.FieldsFunc(elements[1:len(elements)-1], func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t'
+	}) {
+		members, err := parseAddressElement(elem)
+		if err != nil {
+			return err
+		}
+
+		for _, member := range members {
+			if err := set.Add(member); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadNftRuleset reads the output of "nft list ruleset". Sets of ipv4_addr
+// and ipv6_addr elements are supported. The ACL of a chain gets the rules
+// built from address, protocol and port matches, comments and the accept,
+// drop and reject verdicts. Other rules are kept as opaque rules, with a
+// warning for each of them.
+func ReadNftRuleset(r io.Reader) ([]*NftTable, []*LineError, error) {
+	tables := []*NftTable{}
+	warnings := []*LineError{}
+	var table *NftTable
+	var set *IPSet
+	var chain *NftChain
+	elements := ""
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Element lists can span several lines.
+		if elements != "" {
+			elements += " " + line
+			if !strings.Contains(line, "}") {
+				continue
+			}
+			line = elements
+			elements = ""
+		}
+
+		fields := strings.Fields(line)
+		var err error
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case line == "}":
+			switch {
+			case set != nil:
+				set = nil
+			case chain != nil:
+				chain = nil
+			case table != nil:
+				table = nil
+			default:
+				err = fmt.Errorf("unexpected }")
+			}
+		case table == nil:
+			if len(fields) != 4 || fields[0] != "table" || fields[3] != "{" {
+				err = fmt.Errorf("expected table definition")
+				break
+			}
+			table = &NftTable{Family: fields[1], Name: fields[2]}
+			tables = append(tables, table)
+		case set != nil:
+			switch {
+			case fields[0] == "elements":
+				if !strings.Contains(line, "}") {
+					elements = line
+					continue
+				}
+				err = parseNftElements(set, line[strings.Index(line, "{"):])
+			case fields[0] == "type" && len(fields) == 2:
+				if fields[1] != "ipv4_addr" && fields[1] != "ipv6_addr" {
+					err = fmt.Errorf("unsupported set type %s", fields[1])
+				}
+				set.Type = fields[1]
+				set.IPv6 = fields[1] == "ipv6_addr"
+			default:
+				set.Options = strings.TrimPrefix(set.Options+"\n"+line, "\n")
+			}
+		case chain != nil:
+			if fields[0] == "type" {
+				chain.Hook = line
+				if idx := strings.Index(line, "policy "); idx >= 0 {
+					chain.Hook = strings.TrimSpace(line[:idx])
+					chain.Policy = strings.TrimSuffix(strings.TrimSpace(line[idx+len("policy "):]), ";")
+					chain.ACL.Default = policyToAction(strings.ToUpper(chain.Policy))
+				}
+				break
+			}
+
+			var args []string
+			if args, err = splitQuoted(line); err != nil {
+				break
+			}
+
+			rule, ruleErr := parseNftRule(args)
+			if ruleErr == nil {
+				ruleErr = chain.ACL.Add(rule)
+			}
+			if ruleErr != nil {
+				chain.ACL.AddOpaque(line)
+				warnings = append(warnings, &LineError{Line: lineNum, Err: ruleErr})
+			}
+		case len(fields) == 3 && fields[0] == "set" && fields[2] == "{":
+			set = &IPSet{Name: fields[1], members: NewTable()}
+			table.Sets = append(table.Sets, set)
+		case len(fields) == 3 && fields[0] == "chain" && fields[2] == "{":
+			chain = &NftChain{Name: fields[1], ACL: NewACL(ActionAccept)}
+			table.Chains = append(table.Chains, chain)
+		default:
+			err = fmt.Errorf("unsupported line")
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if table != nil || elements != "" {
+		return nil, nil, fmt.Errorf("unexpected end of ruleset")
+	}
+
+	return tables, warnings, nil
+}
+
+func formatNftRule(r *Rule) string {
+	parts := []string{}
+	for _, match := range []struct {
+		s   *Subnet
+		dir string
+	}{{r.Src, "saddr"}, {r.Dst, "daddr"}} {
+		if match.s == nil {
+			continue
+		}
+		family := "ip"
+		if match.s.isIPv6 {
+			family = "ip6"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", family, match.dir, formatAddressElement(match.s)))
+	}
+
+	if r.Protocol != ProtocolAny && r.SrcPorts == nil && r.DstPorts == nil {
+		proto := r.Protocol.String()
+		if r.Protocol == ProtocolICMPv6 {
+			proto = "ipv6-icmp"
+		}
+		parts = append(parts, fmt.Sprintf("meta l4proto %s", proto))
+	}
+	if r.SrcPorts != nil {
+		parts = append(parts, fmt.Sprintf("%s sport %s", r.Protocol, r.SrcPorts))
+	}
+	if r.DstPorts != nil {
+		parts = append(parts, fmt.Sprintf("%s dport %s", r.Protocol, r.DstPorts))
+	}
+
+	parts = append(parts, r.Action.String())
+	if r.Name != "" {
+		parts = append(parts, "comment "+strconv.Quote(r.Name))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// WriteNftRuleset writes the tables in the format of "nft list ruleset".
+func WriteNftRuleset(w io.Writer, tables []*NftTable) error {
+	b := &strings.Builder{}
+	for _, table := range tables {
+		fmt.Fprintf(b, "table %s %s {\n", table.Family, table.Name)
+
+		blocks := []string{}
+		for _, set := range table.Sets {
+			block := &strings.Builder{}
+			fmt.Fprintf(block, "\tset %s {\n", set.Name)
+			fmt.Fprintf(block, "\t\ttype %s\n", set.Type)
+			if set.Options != "" {
+				for _, option := range strings.Split(set.Options, "\n") {
+					fmt.Fprintf(block, "\t\t%s\n", option)
+				}
+			}
+
+			elements := []string{}
+			for _, member := range set.Members() {
+				elements = append(elements, formatAddressElement(member))
+			}
+			if len(elements) > 0 {
+				fmt.Fprintf(block, "\t\telements = { %s }\n", strings.Join(elements, ", "))
+			}
+			block.WriteString("\t}\n")
+			blocks = append(blocks, block.String())
+		}
+
+		for _, chain := range table.Chains {
+			block := &strings.Builder{}
+			fmt.Fprintf(block, "\tchain %s {\n", chain.Name)
+			if chain.Hook != "" {
+				fmt.Fprintf(block, "\t\t%s", chain.Hook)
+				if chain.Policy != "" {
+					fmt.Fprintf(block, " policy %s;", chain.Policy)
+				}
+				block.WriteString("\n")
+			}
+			for _, line := range chainRules(chain.ACL, formatNftRule) {
+				fmt.Fprintf(block, "\t\t%s\n", line)
+			}
+			block.WriteString("\t}\n")
+			blocks = append(blocks, block.String())
+		}
+
+		b.WriteString(strings.Join(blocks, "\n"))
+		b.WriteString("}\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
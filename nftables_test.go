@@ -0,0 +1,184 @@
+package ipcalc
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// nftRuleset is the ruleset of a small router, made by nft list ruleset of
+// nftables v1.0.6.
+const nftRuleset = `table inet filter {
+	set blocklist {
+		type ipv4_addr
+		flags interval
+		elements = { 10.0.0.0/8, 192.0.2.1, 198.51.100.0/24 }
+	}
+
+	set admins6 {
+		type ipv6_addr
+		elements = { 2001:db8::1, 2001:db8::2 }
+	}
+
+	chain input {
+		type filter hook input priority filter; policy drop;
+		iifname "lo" accept
+		ct state established,related accept
+		ct state invalid drop
+		ip saddr 10.0.0.0/24 ip daddr 192.168.1.0/24 tcp dport 22 accept comment "admin ssh"
+		ip saddr @blocklist counter packets 12 bytes 720 drop
+		ip saddr != 192.168.0.0/16 tcp dport 8080 drop
+		ip saddr 10.0.0.0/8 reject
+		udp sport 1024-65535 udp dport 53 accept
+		meta l4proto icmp accept
+		ip6 saddr 2001:db8::/32 meta l4proto ipv6-icmp accept
+		tcp dport { 80, 443 } accept
+		jump logdrop
+	}
+
+	chain forward {
+		type filter hook forward priority filter; policy drop;
+		iifname "br0" oifname "eth0" accept
+		ip daddr 192.0.2.1 drop
+	}
+
+	chain logdrop {
+		limit rate 5/minute log prefix "nft drop: "
+		drop
+	}
+}
+table ip nat {
+	chain postrouting {
+		type nat hook postrouting priority srcnat; policy accept;
+		ip saddr 192.168.1.0/24 oifname "eth0" masquerade
+	}
+}
+`
+
+func TestNftRoundTrip(t *testing.T) {
+	tables, warnings, err := ReadNftRuleset(strings.NewReader(nftRuleset))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 2 || len(tables[0].Sets) != 2 || len(tables[0].Chains) != 3 {
+		t.Fatalf("got unexpected tables %v", tables)
+	}
+
+	got := []string{}
+	for _, w := range warnings {
+		got = append(got, w.Error())
+	}
+	want := []string{
+		"line 15: unsupported statement iifname",
+		"line 16: unsupported statement ct",
+		"line 17: unsupported statement ct",
+		"line 19: set references are not supported",
+		"line 20: negated matches are not supported",
+		"line 25: set references are not supported",
+		"line 26: unsupported statement jump",
+		"line 31: unsupported statement iifname",
+		"line 36: unsupported statement limit",
+		"line 43: unsupported statement oifname",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got warnings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	blocklist := tables[0].Sets[0]
+	if blocklist.Len() != 3 || !blocklist.Contains(net.ParseIP("10.20.30.40")) {
+		t.Errorf("got wrong blocklist members %v", blocklist.Members())
+	}
+
+	input := tables[0].Chains[0].ACL
+	if input.Default != ActionDrop || input.Len() != 5 || len(tables[0].Chains[0].ACL.Opaque()) != 7 {
+		t.Errorf("got default %s and %d rules", input.Default, input.Len())
+	}
+
+	packet := Packet{net.ParseIP("192.0.2.5"), net.ParseIP("192.0.2.53"), ProtocolUDP, 40000, 53}
+	if _, got := input.Evaluate(packet); got != 2 {
+		t.Errorf("got rule %d, want 2", got)
+	}
+
+	b := &strings.Builder{}
+	if err := WriteNftRuleset(b, tables); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != nftRuleset {
+		t.Errorf("got\n%s\nwant\n%s", b, nftRuleset)
+	}
+}
+
+func TestReadNftMultilineElements(t *testing.T) {
+	input := `table ip nat {
+	set pool {
+		type ipv4_addr
+		flags interval
+		elements = { 10.0.0.0/24, 10.0.1.0/24,
+			     10.0.2.1-10.0.2.2 }
+	}
+}
+`
+	tables, _, err := ReadNftRuleset(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, member := range tables[0].Sets[0].Members() {
+		got = append(got, member.GetCidr())
+	}
+
+	want := "10.0.0.0/24 10.0.1.0/24 10.0.2.1/32 10.0.2.2/32"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestReadNftRulesetWarnings(t *testing.T) {
+	var tests = []struct {
+		rule, want string
+	}{
+		{"ip ttl 1 drop", "line 4: unsupported match ip ttl"},
+		{"ip saddr 10.0.0.0/8", "line 4: rule without verdict"},
+		{"tcp dport", "line 4: missing value after dport"},
+		{"reject with icmpx type admin-prohibited", "line 4: unsupported statement with"},
+	}
+
+	for _, tt := range tests {
+		input := "table inet filter {\n\tchain input {\n\t\ttype filter hook input priority filter; policy accept;\n\t\t" +
+			tt.rule + "\n\t}\n}\n"
+		tables, warnings, err := ReadNftRuleset(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%q: got error %v", tt.rule, err)
+			continue
+		}
+
+		if len(warnings) != 1 || warnings[0].Error() != tt.want {
+			t.Errorf("%q: got warnings %v, want %s", tt.rule, warnings, tt.want)
+		}
+
+		if opaque := tables[0].Chains[0].ACL.Opaque(); len(opaque) != 1 || opaque[0].Text != tt.rule {
+			t.Errorf("%q: got opaque rules %v", tt.rule, opaque)
+		}
+	}
+}
+
+func TestReadNftRulesetErrors(t *testing.T) {
+	var tests = []struct {
+		input, want string
+	}{
+		{"table inet filter {\n", "unexpected end of ruleset"},
+		{"table inet filter {\n\tchain input {\n\t\tcomment \"open accept\n\t}\n}\n", "line 3: unterminated quote"},
+		{"table inet filter {\n\tset ports {\n\t\ttype inet_service\n\t}\n}\n", "line 3: unsupported set type inet_service"},
+		{"}\n", "line 1: unexpected }"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := ReadNftRuleset(strings.NewReader(tt.input))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: got error %v, want %s", tt.input, err, tt.want)
+		}
+	}
+}
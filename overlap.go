@@ -0,0 +1,187 @@
+package ipcalc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vrgakos/uint128"
+)
+
+// PrefixList is a named list of entries: cidrs, single addresses or
+// "first-last" ranges.
+type PrefixList struct {
+	Name    string
+	Entries []string
+}
+
+type OverlapKind uint8
+
+const (
+	// OverlapIdentical entries have the same addresses.
+	OverlapIdentical OverlapKind = iota
+	// OverlapContains entries: entry A contains every address of entry B.
+	OverlapContains
+	// OverlapPartial entries share some addresses, only ranges can do that.
+	OverlapPartial
+)
+
+func (k OverlapKind) String() string {
+	switch k {
+	case OverlapIdentical:
+		return "identical"
+	case OverlapContains:
+		return "contains"
+	case OverlapPartial:
+		return "partial"
+	}
+
+	return fmt.Sprintf("OverlapKind(%d)", uint8(k))
+}
+
+// Overlap is a pair of overlapping entries of two lists.
+type Overlap struct {
+	Kind   OverlapKind
+	ListA  string
+	EntryA string
+	ListB  string
+	EntryB string
+	// Range is the addresses of both entries.
+	Range *Range
+}
+
+func (o *Overlap) String() string {
+	first, last := rangeIP(o.Range.Start, o.Range.Bits), rangeIP(o.Range.End, o.Range.Bits)
+	return fmt.Sprintf("%s %s %s %s %s: %s-%s", o.ListA, o.EntryA, o.Kind, o.ListB, o.EntryB, first, last)
+}
+
+type overlapEntry struct {
+	list       int
+	seq        int
+	elem       string
+	pieces     int
+	start, end uint128.Uint128
+	bits       int
+}
+
+func (e *overlapEntry) covers(o *overlapEntry) bool {
+	return e.start.Cmp(o.start) <= 0 && e.end.Cmp(o.end) >= 0
+}
+
+// FindOverlaps reports every pair of overlapping entries of different lists,
+// in address order. The entries are put into one tree, so only the entries
+// on the same path of the tree are compared.
+func FindOverlaps(lists []*PrefixList) ([]*Overlap, error) {
+	table := NewTable()
+	owners := map[*Subnet][]*overlapEntry{}
+	entries := []*overlapEntry{}
+
+	for i, list := range lists {
+		for _, elem := range list.Entries {
+			subnets, err := parseAddressElement(elem)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", list.Name, err)
+			}
+
+			first, last := subnets[0], subnets[len(subnets)-1]
+			e := &overlapEntry{
+				list:   i,
+				seq:    len(entries),
+				elem:   elem,
+				pieces: len(subnets),
+				start:  first.NetInt,
+				end:    last.lastInt(),
+				bits:   int(first.totalNumberOfBits()),
+			}
+			entries = append(entries, e)
+
+			for _, s := range subnets {
+				node, err := table.insertOrFind(s)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", list.Name, err)
+				}
+				owners[node] = append(owners[node], e)
+			}
+		}
+	}
+
+	pairs := map[[2]int]bool{}
+	res := []*Overlap{}
+	report := func(a, b *overlapEntry) {
+		if a.list == b.list || a == b {
+			return
+		}
+		if a.seq > b.seq {
+			a, b = b, a
+		}
+		// Entries of a single prefix meet only once.
+		if a.pieces > 1 || b.pieces > 1 {
+			if pairs[[2]int{a.seq, b.seq}] {
+				return
+			}
+			pairs[[2]int{a.seq, b.seq}] = true
+		}
+
+		o := &Overlap{Kind: OverlapPartial}
+		switch {
+		case a.start.Equals(b.start) && a.end.Equals(b.end):
+			o.Kind = OverlapIdentical
+		case a.covers(b):
+			o.Kind = OverlapContains
+		case b.covers(a):
+			o.Kind = OverlapContains
+			a, b = b, a
+		}
+		o.ListA, o.EntryA = lists[a.list].Name, a.elem
+		o.ListB, o.EntryB = lists[b.list].Name, b.elem
+
+		start, end := a.start, a.end
+		if b.start.Cmp(start) > 0 {
+			start = b.start
+		}
+		if b.end.Cmp(end) < 0 {
+			end = b.end
+		}
+		o.Range = newRangeFromInt(start, end, a.bits)
+		res = append(res, o)
+	}
+
+	// Every node overlaps the nodes above it on its path.
+	var visit func(n *Subnet, above []*overlapEntry)
+	visit = func(n *Subnet, above []*overlapEntry) {
+		if n == nil {
+			return
+		}
+
+		here := owners[n]
+		for i, e := range here {
+			for _, other := range above {
+				report(other, e)
+			}
+			for _, other := range here[i+1:] {
+				report(e, other)
+			}
+		}
+
+		if len(here) > 0 {
+			above = append(above[:len(above):len(above)], here...)
+		}
+		for _, child := range n.children {
+			visit(child, above)
+		}
+	}
+	visit(table.ipv4, nil)
+	visit(table.ipv6, nil)
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i].Range, res[j].Range
+		if a.Bits != b.Bits {
+			return a.Bits < b.Bits
+		}
+		if c := a.Start.Cmp(b.Start); c != 0 {
+			return c < 0
+		}
+		return a.End.Cmp(b.End) > 0
+	})
+
+	return res, nil
+}
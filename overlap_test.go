@@ -0,0 +1,90 @@
+package ipcalc
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestFindOverlaps(t *testing.T) {
+	lists := []*PrefixList{
+		{Name: "team-a", Entries: []string{"10.0.0.0/8", "192.0.2.0/24", "2001:db8::/32", "198.51.100.0-198.51.100.99"}},
+		{Name: "team-b", Entries: []string{"10.1.0.0/16", "10.1.2.0/24", "192.0.2.0/24", "172.16.0.0/12"}},
+		{Name: "cloud", Entries: []string{"2001:db8:1::/48", "198.51.100.50-198.51.100.150", "10.1.2.3", "203.0.113.0/24"}},
+	}
+
+	overlaps, err := FindOverlaps(lists)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"team-a 10.0.0.0/8 contains team-b 10.1.0.0/16: 10.1.0.0-10.1.255.255",
+		"team-a 10.0.0.0/8 contains team-b 10.1.2.0/24: 10.1.2.0-10.1.2.255",
+		"team-a 10.0.0.0/8 contains cloud 10.1.2.3: 10.1.2.3-10.1.2.3",
+		"team-b 10.1.0.0/16 contains cloud 10.1.2.3: 10.1.2.3-10.1.2.3",
+		"team-b 10.1.2.0/24 contains cloud 10.1.2.3: 10.1.2.3-10.1.2.3",
+		"team-a 192.0.2.0/24 identical team-b 192.0.2.0/24: 192.0.2.0-192.0.2.255",
+		"team-a 198.51.100.0-198.51.100.99 partial cloud 198.51.100.50-198.51.100.150: 198.51.100.50-198.51.100.99",
+		"team-a 2001:db8::/32 contains cloud 2001:db8:1::/48: 2001:db8:1::-2001:db8:1:ffff:ffff:ffff:ffff:ffff",
+	}
+
+	got := []string{}
+	for _, o := range overlaps {
+		got = append(got, o.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, err := FindOverlaps([]*PrefixList{{Name: "bad", Entries: []string{"10.0.0.0/33"}}}); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestFindOverlapsRandom(t *testing.T) {
+	lists := []*PrefixList{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	for i := 0; i < 300; i++ {
+		list := lists[rand.Intn(len(lists))]
+		list.Entries = append(list.Entries, fmt.Sprintf("10.%d.%d.0/%d", rand.Intn(4), rand.Intn(256), 14+rand.Intn(11)))
+	}
+
+	overlaps, err := FindOverlaps(lists)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare every pair.
+	want := 0
+	for i, a := range lists {
+		for _, b := range lists[i+1:] {
+			for _, ea := range a.Entries {
+				for _, eb := range b.Entries {
+					sa, sb := NewSubnet(ea), NewSubnet(eb)
+					if sa.Covers(sb) || sb.Covers(sa) {
+						want++
+					}
+				}
+			}
+		}
+	}
+
+	if got := len(overlaps); got != want {
+		t.Errorf("got %d overlaps, want %d", got, want)
+	}
+}
+
+func BenchmarkFindOverlaps(b *testing.B) {
+	lists := []*PrefixList{{Name: "a"}, {Name: "b"}}
+	for i, cidr := range randSubnets(100000) {
+		lists[i%2].Entries = append(lists[i%2].Entries, cidr)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := FindOverlaps(lists); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ipcalc
+
+import (
+	"github.com/vrgakos/uint128"
+)
+
+const feistelRounds = 8
+
+// Permutation is a keyed pseudo-random bijection of the offsets [0, Size),
+// to visit the addresses of a range in a random order without keeping them
+// in memory. It is a balanced Feistel network over the smallest even number
+// of bits covering Size, values outside of Size are walked through the
+// network again until they fall inside (cycle walking).
+type Permutation struct {
+	size RangeSize
+	half uint   // bits of a Feistel half
+	mask uint64 // of a half
+	keys [feistelRounds]uint64
+}
+
+// splitMix64 is the finalizer of the SplitMix64 generator.
+func splitMix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// NewPermutation returns the permutation of size selected by seed, the
+// same seed gives the same order.
+func NewPermutation(size RangeSize, seed uint64) *Permutation {
+	p := &Permutation{size: size}
+
+	p.half = uint(size.Last().Len()+1) / 2
+	if p.half == 0 {
+		p.half = 1
+	}
+	p.mask = ^uint64(0) >> (64 - p.half)
+
+	for i := range p.keys {
+		seed += 0x9e3779b97f4a7c15
+		p.keys[i] = splitMix64(seed)
+	}
+
+	return p
+}
+
+// Permutation returns the permutation of the offsets of r selected by seed.
+func (r *Range) Permutation(seed uint64) *Permutation {
+	return NewPermutation(r.Size, seed)
+}
+
+func (p *Permutation) round(i int, x uint64) uint64 {
+	return splitMix64(x^p.keys[i]) & p.mask
+}
+
+func (p *Permutation) split(x uint128.Uint128) (uint64, uint64) {
+	return x.Rsh(p.half).Lo, x.Lo & p.mask
+}
+
+func (p *Permutation) join(l, r uint64) uint128.Uint128 {
+	return uint128.From64(l).Lsh(p.half).Or64(r)
+}
+
+func (p *Permutation) encrypt(x uint128.Uint128) uint128.Uint128 {
+	l, r := p.split(x)
+	for i := 0; i < feistelRounds; i++ {
+		l, r = r, l^p.round(i, r)
+	}
+
+	return p.join(l, r)
+}
+
+func (p *Permutation) decrypt(x uint128.Uint128) uint128.Uint128 {
+	l, r := p.split(x)
+	for i := feistelRounds - 1; i >= 0; i-- {
+		l, r = r^p.round(i, l), l
+	}
+
+	return p.join(l, r)
+}
+
+// Permute returns the offset at position i of the permutation, i has to be
+// less than the size.
+func (p *Permutation) Permute(i uint128.Uint128) uint128.Uint128 {
+	for i = p.encrypt(i); i.Cmp(p.size.Last()) > 0; {
+		i = p.encrypt(i)
+	}
+
+	return i
+}
+
+// Position is the inverse of Permute: the position of offset in the
+// permutation, to resume from a known offset.
+func (p *Permutation) Position(offset uint128.Uint128) uint128.Uint128 {
+	for offset = p.decrypt(offset); offset.Cmp(p.size.Last()) > 0; {
+		offset = p.decrypt(offset)
+	}
+
+	return offset
+}
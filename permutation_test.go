@@ -0,0 +1,108 @@
+package ipcalc
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/vrgakos/uint128"
+)
+
+func TestPermutation(t *testing.T) {
+	for _, size := range []uint64{1, 2, 3, 5, 100, 256, 1000, 4097} {
+		r := newRangeFromInt(uint128.Zero, uint128.From64(size-1), 32)
+		p := r.Permutation(42)
+
+		seen := map[uint64]bool{}
+		fixed := uint64(0)
+		for i := uint64(0); i < size; i++ {
+			offset := p.Permute(uint128.From64(i))
+			if offset.Cmp64(size) >= 0 || seen[offset.Lo] {
+				t.Fatalf("size %d: position %d: got offset %s, want a new offset below %d", size, i, offset, size)
+			}
+			seen[offset.Lo] = true
+			if offset.Lo == i {
+				fixed++
+			}
+
+			if got := p.Position(offset); got.Cmp64(i) != 0 {
+				t.Errorf("size %d: offset %s: got position %s, want %d", size, offset, got, i)
+			}
+		}
+
+		if size >= 100 && fixed > size/10 {
+			t.Errorf("size %d: got %d offsets in place, want at most %d", size, fixed, size/10)
+		}
+	}
+}
+
+func TestPermutationSeed(t *testing.T) {
+	r := testRange("10.0.0.0", "10.0.255.255")
+	a, b, c := r.Permutation(1), r.Permutation(1), r.Permutation(2)
+
+	same := 0
+	for i := uint64(0); i < 1000; i++ {
+		if !a.Permute(uint128.From64(i)).Equals(b.Permute(uint128.From64(i))) {
+			t.Fatalf("position %d: got different offsets for the same seed, want the same", i)
+		}
+		if a.Permute(uint128.From64(i)).Equals(c.Permute(uint128.From64(i))) {
+			same++
+		}
+	}
+	if same > 10 {
+		t.Errorf("got %d offsets the same for seeds 1 and 2, want at most 10", same)
+	}
+}
+
+func TestPermutationLarge(t *testing.T) {
+	for _, r := range []*Range{
+		testRange("::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"),
+		testRange("2001:db8::", "2001:db8::1:0:0:2"),
+		testRange("0.0.0.0", "255.255.255.255"),
+	} {
+		p := r.Permutation(7)
+		for i := 0; i < 1000; i++ {
+			pos := uint128.New(rand.Uint64(), rand.Uint64()).And(r.Size.Last())
+			offset := p.Permute(pos)
+			if r.Size.Cmp(offset) <= 0 || !p.Position(offset).Equals(pos) {
+				t.Fatalf("%s: position %s: got offset %s and back position %s", r, pos, offset, p.Position(offset))
+			}
+		}
+	}
+}
+
+func TestIteratePermutation(t *testing.T) {
+	r := NewSubnet("192.0.2.0/24").Range()
+	p := r.Permutation(99)
+
+	all := []string{}
+	it := r.Iterate(IterateOptions{Permutation: p})
+	for it.Next() {
+		all = append(all, it.IP().String())
+		if !it.IP().Equal(r.GetIpByOffset(it.Offset())) || !p.Permute(it.Position()).Equals(it.Offset()) {
+			t.Fatalf("got %s at offset %s position %s", it.IP(), it.Offset(), it.Position())
+		}
+	}
+	if len(all) != 256 {
+		t.Fatalf("got %d addresses, want 256", len(all))
+	}
+
+	// Stop after 100 addresses and resume.
+	resumed := []string{}
+	it = r.Iterate(IterateOptions{Permutation: p})
+	for i := 0; i < 100 && it.Next(); i++ {
+		resumed = append(resumed, it.IP().String())
+	}
+	it = r.Iterate(IterateOptions{Permutation: p, Offset: it.Position().Add64(1)})
+	for it.Next() {
+		resumed = append(resumed, it.IP().String())
+	}
+
+	if len(resumed) != len(all) {
+		t.Fatalf("got %d resumed addresses, want %d", len(resumed), len(all))
+	}
+	for i := range all {
+		if all[i] != resumed[i] {
+			t.Fatalf("position %d: got %s resumed, want %s", i, resumed[i], all[i])
+		}
+	}
+}
@@ -2,19 +2,79 @@ package ipcalc
 
 import (
 	"fmt"
+	"math/big"
 	"net"
 
 	"github.com/vrgakos/uint128"
 )
 
+// Range is the addresses from Start to End, both included.
 type Range struct {
 	// Subnet *Subnet
 	Bits  int
 	Start uint128.Uint128
 	End   uint128.Uint128
-	Size  uint128.Uint128
+	Size  RangeSize
 }
 
+// RangeSize is the number of addresses of a range. It is kept as the last
+// offset, so the 2^128 addresses of the whole IPv6 space fit too.
+type RangeSize struct {
+	last uint128.Uint128
+}
+
+// Last returns the last offset, the size minus one.
+func (s RangeSize) Last() uint128.Uint128 {
+	return s.last
+}
+
+// Uint128 returns the size, ok is false for 2^128.
+func (s RangeSize) Uint128() (size uint128.Uint128, ok bool) {
+	if s.last.Equals(uint128.Max) {
+		return uint128.Zero, false
+	}
+
+	return s.last.Add64(1), true
+}
+
+func (s RangeSize) Big() *big.Int {
+	return new(big.Int).Add(s.last.Big(), big.NewInt(1))
+}
+
+func (s RangeSize) String() string {
+	return s.Big().String()
+}
+
+// Cmp compares the size to v.
+func (s RangeSize) Cmp(v uint128.Uint128) int {
+	size, ok := s.Uint128()
+	if !ok {
+		return 1
+	}
+
+	return size.Cmp(v)
+}
+
+func (s RangeSize) Cmp64(v uint64) int {
+	return s.Cmp(uint128.From64(v))
+}
+
+// QuoRem64 divides the size by v.
+func (s RangeSize) QuoRem64(v uint64) (uint128.Uint128, uint64) {
+	if size, ok := s.Uint128(); ok {
+		return size.QuoRem64(v)
+	}
+
+	// 2^128 = Max + 1
+	q, r := uint128.Max.QuoRem64(v)
+	if r+1 == v {
+		return q.Add64(1), 0
+	}
+	return q, r + 1
+}
+
+// NewRange returns the range of start to end, or nil when they are of
+// different families or end is before start.
 func NewRange(start, end net.IP) *Range {
 	res := &Range{}
 	var startBits, endBits int
@@ -27,15 +87,56 @@ func NewRange(start, end net.IP) *Range {
 	}
 	res.Bits = startBits
 
-	if res.Start.Cmp(res.End) >= 0 {
+	if res.Start.Cmp(res.End) > 0 {
 		return nil
 	}
 
-	res.Size = res.End.Sub(res.Start).Add64(1)
+	res.Size = RangeSize{last: res.End.Sub(res.Start)}
 
 	return res
 }
 
+// newRangeFromInt returns the range of start to end, which can be a single
+// address.
+func newRangeFromInt(start, end uint128.Uint128, bits int) *Range {
+	return &Range{
+		Bits:  bits,
+		Start: start,
+		End:   end,
+		Size:  RangeSize{last: end.Sub(start)},
+	}
+}
+
+// Range returns the addresses of s.
+func (s *Subnet) Range() *Range {
+	return newRangeFromInt(s.NetInt, s.lastInt(), int(s.totalNumberOfBits()))
+}
+
+// HostRange returns the usable host addresses of s. IPv4 subnets up to /30
+// lose their network and broadcast address, IPv6 subnets up to /126 their
+// Subnet-Router anycast address. /31 and /127 point-to-point links use both
+// of their addresses (RFC 3021, RFC 6164).
+func (s *Subnet) HostRange() *Range {
+	r := s.Range()
+	if s.isIPv6 && s.NetOnes <= 126 {
+		return newRangeFromInt(r.Start.Add64(1), r.End, r.Bits)
+	}
+	if !s.isIPv6 && s.NetOnes <= 30 {
+		return newRangeFromInt(r.Start.Add64(1), r.End.Sub64(1), r.Bits)
+	}
+
+	return r
+}
+
+// rangeIP converts an address of a range with bits to net.IP.
+func rangeIP(i uint128.Uint128, bits int) net.IP {
+	if bits == 32 {
+		return intToIPv4(i)
+	}
+
+	return intToIPv6(i)
+}
+
 func ParseRange(start, end string) (*Range, error) {
 	startIp := net.ParseIP(start)
 	if startIp == nil {
@@ -102,7 +203,7 @@ func (r *Range) GetOffsetByIp(ip string) (uint128.Uint128, error) {
 	}
 
 	offset := intIp.SubWrap(r.Start)
-	if offset.Cmp(r.Size) >= 0 {
+	if r.Size.Cmp(offset) <= 0 {
 		return uint128.Zero, fmt.Errorf("offset out of range")
 	}
 
@@ -117,3 +218,173 @@ func (r *Range) GetOffset64ByIp(ip string) (uint64, error) {
 
 	return offset.Lo, nil
 }
+
+// Subnets returns the smallest list of subnets covering exactly the range,
+// in address order.
+func (r *Range) Subnets() []*Subnet {
+	return rangeToSubnets(r.Start, r.End, r.Bits)
+}
+
+func rangeToSubnets(start, end uint128.Uint128, bits int) []*Subnet {
+	res := []*Subnet{}
+
+	for start.Cmp(end) <= 0 {
+		hostBits := start.TrailingZeros()
+		if hostBits > bits {
+			hostBits = bits
+		}
+
+		last := start.Or(uint128.Max.Rsh(uint(128 - hostBits)))
+		for last.Cmp(end) > 0 {
+			hostBits--
+			last = start.Or(uint128.Max.Rsh(uint(128 - hostBits)))
+		}
+
+		res = append(res, newSubnetFromInt(start, uint8(bits-hostBits), bits == 128))
+		if last.Cmp(end) == 0 {
+			break
+		}
+		start = last.Add64(1)
+	}
+
+	return res
+}
+
+// rangeMax returns the last address of the family with bits.
+func rangeMax(bits int) uint128.Uint128 {
+	return maskToInt(bits, bits)
+}
+
+func (r *Range) String() string {
+	return fmt.Sprintf("%s-%s", rangeIP(r.Start, r.Bits), rangeIP(r.End, r.Bits))
+}
+
+func (r *Range) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	i, bits := ipToInt(ip)
+	return bits == r.Bits && i.Cmp(r.Start) >= 0 && i.Cmp(r.End) <= 0
+}
+
+func (r *Range) Overlaps(o *Range) bool {
+	return r.Bits == o.Bits && r.Start.Cmp(o.End) <= 0 && o.Start.Cmp(r.End) <= 0
+}
+
+// Intersect returns the addresses in both ranges, or nil.
+func (r *Range) Intersect(o *Range) *Range {
+	if !r.Overlaps(o) {
+		return nil
+	}
+
+	start, end := r.Start, r.End
+	if o.Start.Cmp(start) > 0 {
+		start = o.Start
+	}
+	if o.End.Cmp(end) < 0 {
+		end = o.End
+	}
+
+	return newRangeFromInt(start, end, r.Bits)
+}
+
+// Union returns the addresses in either range, or nil when the ranges
+// neither overlap nor are adjacent.
+func (r *Range) Union(o *Range) *Range {
+	if r.Bits != o.Bits {
+		return nil
+	}
+
+	first, second := r, o
+	if o.Start.Cmp(r.Start) < 0 {
+		first, second = o, r
+	}
+	if !first.End.Equals(rangeMax(r.Bits)) && first.End.Add64(1).Cmp(second.Start) < 0 {
+		return nil
+	}
+
+	end := first.End
+	if second.End.Cmp(end) > 0 {
+		end = second.End
+	}
+
+	return newRangeFromInt(first.Start, end, r.Bits)
+}
+
+// Subtract returns the addresses of r not in o: zero, one or two ranges.
+func (r *Range) Subtract(o *Range) []*Range {
+	if !r.Overlaps(o) {
+		return []*Range{r}
+	}
+
+	res := []*Range{}
+	if o.Start.Cmp(r.Start) > 0 {
+		res = append(res, newRangeFromInt(r.Start, o.Start.Sub64(1), r.Bits))
+	}
+	if o.End.Cmp(r.End) < 0 {
+		res = append(res, newRangeFromInt(o.End.Add64(1), r.End, r.Bits))
+	}
+
+	return res
+}
+
+// SplitN splits r into parts ranges, the sizes differ by at most one.
+func (r *Range) SplitN(parts int) ([]*Range, error) {
+	if parts < 1 || r.Size.Cmp64(uint64(parts)) < 0 {
+		return nil, fmt.Errorf("can not split %s addresses into %d parts", r.Size, parts)
+	}
+
+	size, rem := r.Size.QuoRem64(uint64(parts))
+	res := make([]*Range, 0, parts)
+	start := r.Start
+	for i := 0; i < parts; i++ {
+		partSize := size
+		if uint64(i) < rem {
+			partSize = partSize.Add64(1)
+		}
+
+		end := start.Add(partSize.Sub64(1))
+		res = append(res, newRangeFromInt(start, end, r.Bits))
+		if i < parts-1 {
+			start = end.Add64(1)
+		}
+	}
+
+	return res, nil
+}
+
+// SplitAt splits r into the addresses before ip and the ones from ip.
+func (r *Range) SplitAt(ip net.IP) (*Range, *Range, error) {
+	if !r.Contains(ip) {
+		return nil, nil, fmt.Errorf("ip address out of range")
+	}
+
+	i, _ := ipToInt(ip)
+	if i.Equals(r.Start) {
+		return nil, nil, fmt.Errorf("nothing before the start of the range")
+	}
+
+	return newRangeFromInt(r.Start, i.Sub64(1), r.Bits), newRangeFromInt(i, r.End, r.Bits), nil
+}
+
+// Expand returns r with n more addresses on both ends.
+func (r *Range) Expand(n uint128.Uint128) (*Range, error) {
+	if r.Start.Cmp(n) < 0 {
+		return nil, fmt.Errorf("expanding by %s goes before the first address", n)
+	}
+	if rangeMax(r.Bits).Sub(r.End).Cmp(n) < 0 {
+		return nil, fmt.Errorf("expanding by %s goes after the last address", n)
+	}
+
+	return newRangeFromInt(r.Start.Sub(n), r.End.Add(n), r.Bits), nil
+}
+
+// Shrink returns r with n less addresses on both ends.
+func (r *Range) Shrink(n uint128.Uint128) (*Range, error) {
+	if n.Cmp(r.Size.Last().Rsh(1)) > 0 {
+		return nil, fmt.Errorf("shrinking %s addresses by %s on both ends leaves nothing", r.Size, n)
+	}
+
+	return newRangeFromInt(r.Start.Add(n), r.End.Sub(n), r.Bits), nil
+}
@@ -1,7 +1,11 @@
 package ipcalc
 
 import (
+	"net"
+	"strings"
 	"testing"
+
+	"github.com/vrgakos/uint128"
 )
 
 func TestRangeParse(t *testing.T) {
@@ -11,12 +15,16 @@ func TestRangeParse(t *testing.T) {
 	}{
 		{"192.168.0.1", "192.168.0.2", "2"},
 		{"192.168.0.5", "192.168.0.9", "5"},
+		{"192.168.0.5", "192.168.0.5", "1"},
+		{"0.0.0.0", "255.255.255.255", "4294967296"},
 		{"192.0.0.100", "192.0.0.199", "100"},
 		{"192.0.0.199", "192.0.0.100", ""},
 		{"192.0.0.199", "2001:db8::ff", ""},
 		{"2001:db8::1", "2001:db8::2", "2"},
 		{"2001:db8::1", "2001:db8::ffff", "65535"},
 		{"2001:eb8::1", "2001:a::1", ""},
+		{"::", "::", "1"},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "340282366920938463463374607431768211456"},
 	}
 
 	for _, tt := range tests {
@@ -35,3 +43,225 @@ func TestRangeParse(t *testing.T) {
 		}
 	}
 }
+
+func TestRangeSubnets(t *testing.T) {
+	var tests = []struct {
+		start, end string
+		want       string
+	}{
+		{"192.168.0.0", "192.168.0.255", "192.168.0.0/24"},
+		{"192.168.0.1", "192.168.0.6", "192.168.0.1/32 192.168.0.2/31 192.168.0.4/31 192.168.0.6/32"},
+		{"10.0.0.0", "10.0.2.127", "10.0.0.0/23 10.0.2.0/25"},
+		{"0.0.0.0", "255.255.255.255", "0.0.0.0/0"},
+		{"255.255.255.254", "255.255.255.255", "255.255.255.254/31"},
+		{"2001:db8::", "2001:db8::1:ffff", "2001:db8::/111"},
+		{"2001:db8::1", "2001:db8::3", "2001:db8::1/128 2001:db8::2/127"},
+		{"10.0.0.1", "10.0.0.1", "10.0.0.1/32"},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "::/0"},
+	}
+
+	for _, tt := range tests {
+		r, _ := ParseRange(tt.start, tt.end)
+
+		got := []string{}
+		for _, s := range r.Subnets() {
+			got = append(got, s.GetCidr())
+		}
+
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s-%s: got %s, want %s", tt.start, tt.end, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+func TestRangeExtremes(t *testing.T) {
+	var tests = []struct {
+		start, end string
+		wantLast   uint128.Uint128
+	}{
+		{"0.0.0.0", "255.255.255.255", uint128.From64(1<<32 - 1)},
+		{"255.255.255.255", "255.255.255.255", uint128.Zero},
+		{"::", "::", uint128.Zero},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", uint128.Max},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", uint128.Zero},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.start, tt.end)
+		if err != nil || r == nil {
+			t.Fatalf("%s-%s: got error %v, wanted success", tt.start, tt.end, err)
+		}
+
+		if got := r.GetIpByOffset(uint128.Zero); !got.Equal(net.ParseIP(tt.start)) {
+			t.Errorf("%s offset 0: got %s, want %s", r, got, tt.start)
+		}
+		if got := r.GetIpByOffset(tt.wantLast); !got.Equal(net.ParseIP(tt.end)) {
+			t.Errorf("%s offset %s: got %s, want %s", r, tt.wantLast, got, tt.end)
+		}
+		if !tt.wantLast.Equals(uint128.Max) {
+			if got := r.GetIpByOffset(tt.wantLast.Add64(1)); got != nil {
+				t.Errorf("%s offset %s: got %s, want nil", r, tt.wantLast.Add64(1), got)
+			}
+		}
+
+		if got, err := r.GetOffsetByIp(tt.start); err != nil || !got.IsZero() {
+			t.Errorf("%s %s: got offset %s and error %v, want 0", r, tt.start, got, err)
+		}
+		if got, err := r.GetOffsetByIp(tt.end); err != nil || !got.Equals(tt.wantLast) {
+			t.Errorf("%s %s: got offset %s and error %v, want %s", r, tt.end, got, err, tt.wantLast)
+		}
+		if got := r.Size.Last(); !got.Equals(tt.wantLast) {
+			t.Errorf("%s: got last offset %s, want %s", r, got, tt.wantLast)
+		}
+	}
+
+	full := testRange("::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")
+	if _, ok := full.Size.Uint128(); ok || full.Size.Cmp(uint128.Max) != 1 {
+		t.Errorf("got size %s, want 2^128", full.Size)
+	}
+	parts, err := full.SplitN(3)
+	if want := "::-5555:5555:5555:5555:5555:5555:5555:5555 5555:5555:5555:5555:5555:5555:5555:5556-aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaaa:aaab-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"; err != nil || rangesString(parts) != want {
+		t.Errorf("got %s and error %v, want %s", rangesString(parts), err, want)
+	}
+	if got, err := full.Shrink(uint128.Max.Rsh(1)); err != nil || got.String() != "7fff:ffff:ffff:ffff:ffff:ffff:ffff:ffff-8000::" {
+		t.Errorf("got %v and error %v, want 7fff:ffff:ffff:ffff:ffff:ffff:ffff:ffff-8000::", got, err)
+	}
+}
+
+func testRange(start, end string) *Range {
+	return NewRange(net.ParseIP(start), net.ParseIP(end))
+}
+
+func rangesString(ranges []*Range) string {
+	res := []string{}
+	for _, r := range ranges {
+		res = append(res, r.String())
+	}
+	return strings.Join(res, " ")
+}
+
+func TestRangeContains(t *testing.T) {
+	var tests = []struct {
+		r    *Range
+		ip   string
+		want bool
+	}{
+		{testRange("0.0.0.0", "0.0.0.255"), "0.0.0.0", true},
+		{testRange("0.0.0.0", "0.0.0.255"), "0.0.1.0", false},
+		{testRange("255.255.255.0", "255.255.255.255"), "255.255.255.255", true},
+		{testRange("255.255.255.0", "255.255.255.255"), "::ffff:ffff", false},
+		{testRange("::", "::ff"), "::", true},
+		{testRange("::", "::ff"), "0.0.0.0", false},
+		{testRange("ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", true},
+		{testRange("ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"), "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.r.Contains(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("%s %s: got %t, want %t", tt.r, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRangeSetOperations(t *testing.T) {
+	var tests = []struct {
+		a, b          *Range
+		wantIntersect string
+		wantUnion     string
+		wantSubtract  string
+	}{
+		{testRange("10.0.0.0", "10.0.0.255"), testRange("10.0.0.128", "10.0.1.255"), "10.0.0.128-10.0.0.255", "10.0.0.0-10.0.1.255", "10.0.0.0-10.0.0.127"},
+		{testRange("10.0.0.0", "10.0.0.255"), testRange("10.0.1.0", "10.0.1.255"), "", "10.0.0.0-10.0.1.255", "10.0.0.0-10.0.0.255"},
+		{testRange("10.0.0.0", "10.0.0.255"), testRange("10.0.1.1", "10.0.1.255"), "", "", "10.0.0.0-10.0.0.255"},
+		{testRange("10.0.0.0", "10.0.0.255"), testRange("10.0.0.10", "10.0.0.10"), "10.0.0.10-10.0.0.10", "10.0.0.0-10.0.0.255", "10.0.0.0-10.0.0.9 10.0.0.11-10.0.0.255"},
+		{testRange("10.0.0.10", "10.0.0.10"), testRange("10.0.0.0", "10.0.0.255"), "10.0.0.10-10.0.0.10", "10.0.0.0-10.0.0.255", ""},
+		{testRange("0.0.0.0", "0.0.0.10"), testRange("0.0.0.0", "0.0.0.0"), "0.0.0.0-0.0.0.0", "0.0.0.0-0.0.0.10", "0.0.0.1-0.0.0.10"},
+		{testRange("255.255.255.0", "255.255.255.255"), testRange("255.255.255.255", "255.255.255.255"), "255.255.255.255-255.255.255.255", "255.255.255.0-255.255.255.255", "255.255.255.0-255.255.255.254"},
+		{testRange("0.0.0.0", "255.255.255.255"), testRange("0.0.0.1", "255.255.255.254"), "0.0.0.1-255.255.255.254", "0.0.0.0-255.255.255.255", "0.0.0.0-0.0.0.0 255.255.255.255-255.255.255.255"},
+		{testRange("::", "::1"), testRange("::2", "::ffff"), "", "::-::ffff", "::-::1"},
+		{testRange("ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), testRange("fffe::", "ffff::"), "ffff::-ffff::", "fffe::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "ffff::1-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{testRange("10.0.0.0", "10.0.0.255"), testRange("::a00:0", "::a00:ff"), "", "", "10.0.0.0-10.0.0.255"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Intersect(tt.b); (got == nil && tt.wantIntersect != "") || (got != nil && got.String() != tt.wantIntersect) {
+			t.Errorf("%s intersect %s: got %v, want %s", tt.a, tt.b, got, tt.wantIntersect)
+		}
+		if got := tt.a.Overlaps(tt.b); got != (tt.wantIntersect != "") {
+			t.Errorf("%s overlaps %s: got %t, want %t", tt.a, tt.b, got, !got)
+		}
+		if got := tt.a.Union(tt.b); (got == nil && tt.wantUnion != "") || (got != nil && got.String() != tt.wantUnion) {
+			t.Errorf("%s union %s: got %v, want %s", tt.a, tt.b, got, tt.wantUnion)
+		}
+		if got := rangesString(tt.a.Subtract(tt.b)); got != tt.wantSubtract {
+			t.Errorf("%s subtract %s: got %s, want %s", tt.a, tt.b, got, tt.wantSubtract)
+		}
+	}
+}
+
+func TestRangeSplit(t *testing.T) {
+	parts, err := testRange("10.0.0.0", "10.0.0.9").SplitN(3)
+	if want := "10.0.0.0-10.0.0.3 10.0.0.4-10.0.0.6 10.0.0.7-10.0.0.9"; err != nil || rangesString(parts) != want {
+		t.Errorf("got %s and error %v, want %s", rangesString(parts), err, want)
+	}
+
+	parts, err = testRange("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffc", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff").SplitN(4)
+	if err != nil || len(parts) != 4 || parts[3].String() != "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff" {
+		t.Errorf("got %s and error %v, want 4 single addresses", rangesString(parts), err)
+	}
+
+	parts, err = testRange("0.0.0.0", "255.255.255.255").SplitN(2)
+	if want := "0.0.0.0-127.255.255.255 128.0.0.0-255.255.255.255"; err != nil || rangesString(parts) != want {
+		t.Errorf("got %s and error %v, want %s", rangesString(parts), err, want)
+	}
+
+	for _, n := range []int{0, -1, 11} {
+		if _, err := testRange("10.0.0.0", "10.0.0.9").SplitN(n); err == nil {
+			t.Errorf("%d parts: got nil error, wanted failure", n)
+		}
+	}
+
+	lower, upper, err := testRange("::", "::ffff").SplitAt(net.ParseIP("::1"))
+	if err != nil || lower.String() != "::-::" || upper.String() != "::1-::ffff" {
+		t.Errorf("got %v %v and error %v, want ::-:: ::1-::ffff", lower, upper, err)
+	}
+
+	lower, upper, err = testRange("10.0.0.0", "255.255.255.255").SplitAt(net.ParseIP("255.255.255.255"))
+	if err != nil || lower.String() != "10.0.0.0-255.255.255.254" || upper.String() != "255.255.255.255-255.255.255.255" {
+		t.Errorf("got %v %v and error %v, want 10.0.0.0-255.255.255.254 255.255.255.255-255.255.255.255", lower, upper, err)
+	}
+
+	for _, ip := range []string{"10.0.0.0", "9.255.255.255", "::a00:1"} {
+		if _, _, err := testRange("10.0.0.0", "10.0.0.9").SplitAt(net.ParseIP(ip)); err == nil {
+			t.Errorf("%s: got nil error, wanted failure", ip)
+		}
+	}
+}
+
+func TestRangeExpandShrink(t *testing.T) {
+	var tests = []struct {
+		r          *Range
+		n          uint64
+		wantExpand string
+		wantShrink string
+	}{
+		{testRange("10.0.0.10", "10.0.0.20"), 5, "10.0.0.5-10.0.0.25", "10.0.0.15-10.0.0.15"},
+		{testRange("10.0.0.10", "10.0.0.20"), 6, "10.0.0.4-10.0.0.26", ""},
+		{testRange("0.0.0.1", "255.255.255.254"), 1, "0.0.0.0-255.255.255.255", "0.0.0.2-255.255.255.253"},
+		{testRange("0.0.0.1", "255.255.255.254"), 2, "", "0.0.0.3-255.255.255.252"},
+		{testRange("::1", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"), 1, "::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "::2-ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffd"},
+		{testRange("::", "::"), 0, "::-::", "::-::"},
+		{testRange("::", "::"), 1, "", ""},
+		{testRange("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fff0", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fff0"), 15, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffe1-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", ""},
+	}
+
+	for _, tt := range tests {
+		n := uint128.From64(tt.n)
+		if got, err := tt.r.Expand(n); (err != nil) != (tt.wantExpand == "") || (err == nil && got.String() != tt.wantExpand) {
+			t.Errorf("%s expand %d: got %v and error %v, want %s", tt.r, tt.n, got, err, tt.wantExpand)
+		}
+		if got, err := tt.r.Shrink(n); (err != nil) != (tt.wantShrink == "") || (err == nil && got.String() != tt.wantShrink) {
+			t.Errorf("%s shrink %d: got %v and error %v, want %s", tt.r, tt.n, got, err, tt.wantShrink)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package ipcalc
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/vrgakos/uint128"
+)
+
+type reverseZone struct {
+	name      string
+	subnet    *Subnet
+	classless bool
+}
+
+// reverseLabels returns the first n octets (IPv4) or nibbles (IPv6) of the
+// network of s, in reverse order.
+func (s *Subnet) reverseLabels(n int) []string {
+	labels := make([]string, n)
+	if s.isIPv6 {
+		hex := fmt.Sprintf("%016x%016x", s.NetInt.Hi, s.NetInt.Lo)
+		for i := 0; i < n; i++ {
+			labels[n-1-i] = hex[i : i+1]
+		}
+		return labels
+	}
+
+	ipv4 := s.GetNetwork().To4()
+	for i := 0; i < n; i++ {
+		labels[n-1-i] = strconv.Itoa(int(ipv4[i]))
+	}
+	return labels
+}
+
+func reverseSuffix(isIPv6 bool) string {
+	if isIPv6 {
+		return "ip6.arpa."
+	}
+
+	return "in-addr.arpa."
+}
+
+func reverseName(labels []string, isIPv6 bool) string {
+	if len(labels) == 0 {
+		return reverseSuffix(isIPv6)
+	}
+
+	return strings.Join(labels, ".") + "." + reverseSuffix(isIPv6)
+}
+
+// ReverseName returns the PTR owner name of ip.
+func ReverseName(ip net.IP) string {
+	s := newHostSubnet(ip)
+	if s == nil {
+		return ""
+	}
+
+	return s.reverseName()
+}
+
+func (s *Subnet) reverseName() string {
+	digitBits := 8
+	if s.isIPv6 {
+		digitBits = 4
+	}
+
+	return reverseName(s.reverseLabels(int(s.NetOnes)/digitBits), s.isIPv6)
+}
+
+func (s *Subnet) reverseZones() []reverseZone {
+	digitBits := uint8(8)
+	if s.isIPv6 {
+		digitBits = 4
+	}
+
+	// RFC 2317 classless delegation for everything longer than a /24.
+	if !s.isIPv6 && s.NetOnes > 24 {
+		if s.NetOnes == 32 {
+			return []reverseZone{{name: s.reverseName(), subnet: s}}
+		}
+
+		ipv4 := s.GetNetwork().To4()
+		first := int(ipv4[3])
+		last := first + 1<<(32-s.NetOnes) - 1
+		labels := append([]string{fmt.Sprintf("%d-%d", first, last)}, s.reverseLabels(3)...)
+		return []reverseZone{{name: reverseName(labels, false), subnet: s, classless: true}}
+	}
+
+	ones := (s.NetOnes + digitBits - 1) / digitBits * digitBits
+	step := uint128.From64(1).Lsh(uint(s.totalNumberOfBits() - ones))
+	zones := make([]reverseZone, 0, 1<<(ones-s.NetOnes))
+
+	netInt := s.NetInt
+	for i := 0; i < 1<<(ones-s.NetOnes); i++ {
+		zone := newSubnetFromInt(netInt, ones, s.isIPv6)
+		zones = append(zones, reverseZone{name: zone.reverseName(), subnet: zone})
+		netInt = netInt.AddWrap(step)
+	}
+
+	return zones
+}
+
+// ReverseZones returns the in-addr.arpa. or ip6.arpa. zones covering the
+// subnet. IPv4 prefixes longer than /24 get an RFC 2317 "first-last" zone,
+// other prefixes are split on octet or nibble boundaries.
+func (s *Subnet) ReverseZones() []string {
+	res := []string{}
+	for _, zone := range s.reverseZones() {
+		res = append(res, zone.name)
+	}
+
+	return res
+}
+
+type PTRZoneOptions struct {
+	TTL         uint32
+	PrimaryNS   string
+	Hostmaster  string
+	NameServers []string // defaults to PrimaryNS
+	Serial      uint32
+	Refresh     uint32
+	Retry       uint32
+	Expire      uint32
+	Minimum     uint32
+}
+
+func (o PTRZoneOptions) withDefaults() PTRZoneOptions {
+	defaults := []struct {
+		value *uint32
+		def   uint32
+	}{
+		{&o.TTL, 3600},
+		{&o.Serial, 1},
+		{&o.Refresh, 3600},
+		{&o.Retry, 600},
+		{&o.Expire, 604800},
+		{&o.Minimum, 3600},
+	}
+	for _, d := range defaults {
+		if *d.value == 0 {
+			*d.value = d.def
+		}
+	}
+
+	if len(o.NameServers) == 0 {
+		o.NameServers = []string{o.PrimaryNS}
+	}
+
+	return o
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// WritePTRZone writes one of the ReverseZones of s in BIND format. The PTR
+// records come from the host nodes (/32 or /128) of the tree under s, their
+// Meta is the host name. Hosts without Meta are skipped.
+func (s *Subnet) WritePTRZone(w io.Writer, zone string, opts PTRZoneOptions) error {
+	if opts.PrimaryNS == "" || opts.Hostmaster == "" {
+		return fmt.Errorf("primary name server and hostmaster are required")
+	}
+	opts = opts.withDefaults()
+
+	var rz *reverseZone
+	for _, candidate := range s.reverseZones() {
+		if candidate.name == fqdn(zone) {
+			rz = &candidate
+			break
+		}
+	}
+	if rz == nil {
+		return fmt.Errorf("%s is not a reverse zone of %s", zone, s.GetCidr())
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "$ORIGIN %s\n", rz.name)
+	fmt.Fprintf(b, "$TTL %d\n", opts.TTL)
+	fmt.Fprintf(b, "@\tIN\tSOA\t%s %s %d %d %d %d %d\n", fqdn(opts.PrimaryNS), fqdn(opts.Hostmaster),
+		opts.Serial, opts.Refresh, opts.Retry, opts.Expire, opts.Minimum)
+	for _, ns := range opts.NameServers {
+		fmt.Fprintf(b, "@\tIN\tNS\t%s\n", fqdn(ns))
+	}
+
+	s.Walk(func(host *Subnet) bool {
+		if !host.IsHostAddress() || host.Meta == "" || !rz.subnet.Covers(host) {
+			return true
+		}
+
+		owner := "@"
+		if rz.classless {
+			owner = host.reverseLabels(4)[0]
+		} else if name := host.reverseName(); name != rz.name {
+			owner = strings.TrimSuffix(name, "."+rz.name)
+		}
+
+		fmt.Fprintf(b, "%s\tIN\tPTR\t%s\n", owner, fqdn(host.Meta))
+		return true
+	})
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func parseReverseOctet(label string) (uint64, error) {
+	if label == "" || len(label) > 3 || (len(label) > 1 && label[0] == '0') {
+		return 0, fmt.Errorf("invalid in-addr.arpa label %q", label)
+	}
+
+	value, err := strconv.ParseUint(label, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid in-addr.arpa label %q", label)
+	}
+
+	return value, nil
+}
+
+// parseClasslessLabel parses the RFC 2317 "first-last" and "first/ones"
+// labels, and returns the first address and the size of the block.
+func parseClasslessLabel(label string) (uint64, uint64, error) {
+	var first, last uint64
+	var err error
+
+	if parts := strings.SplitN(label, "-", 2); len(parts) == 2 {
+		if first, err = parseReverseOctet(parts[0]); err != nil {
+			return 0, 0, err
+		}
+		if last, err = parseReverseOctet(parts[1]); err != nil {
+			return 0, 0, err
+		}
+		if last < first {
+			return 0, 0, fmt.Errorf("invalid classless label %q, last is before first", label)
+		}
+	} else {
+		parts = strings.SplitN(label, "/", 2)
+		if first, err = parseReverseOctet(parts[0]); err != nil {
+			return 0, 0, err
+		}
+		ones, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil || ones < 25 || ones > 32 {
+			return 0, 0, fmt.Errorf("invalid classless label %q, bad prefix length", label)
+		}
+		last = first + 1<<(32-ones) - 1
+	}
+
+	size := last - first + 1
+	if size > 128 || size&(size-1) != 0 || first%size != 0 {
+		return 0, 0, fmt.Errorf("invalid classless label %q, not an aligned block", label)
+	}
+
+	return first, size, nil
+}
+
+func parseReverseIPv4(labels []string) (*Subnet, error) {
+	if len(labels) > 5 {
+		return nil, fmt.Errorf("too many labels in in-addr.arpa name")
+	}
+
+	var netInt uint64
+	var ones uint8
+	for i, label := range labels {
+		if i == 3 && strings.ContainsAny(label, "-/") {
+			first, size, err := parseClasslessLabel(label)
+			if err != nil {
+				return nil, err
+			}
+			netInt = netInt<<8 | first
+			ones = 32 - uint8(bits.Len64(size-1))
+
+			if len(labels) == 5 {
+				host, err := parseReverseOctet(labels[4])
+				if err != nil {
+					return nil, err
+				}
+				if host < first || host >= first+size {
+					return nil, fmt.Errorf("%d is not in the classless block %q", host, label)
+				}
+				netInt = netInt&^0xff | host
+				ones = 32
+			}
+
+			return newSubnetFromInt(uint128.From64(netInt), ones, false), nil
+		}
+
+		if i == 4 {
+			return nil, fmt.Errorf("too many labels in in-addr.arpa name")
+		}
+
+		octet, err := parseReverseOctet(label)
+		if err != nil {
+			return nil, err
+		}
+		netInt = netInt<<8 | octet
+		ones += 8
+	}
+
+	return newSubnetFromInt(uint128.From64(netInt<<(32-ones)), ones, false), nil
+}
+
+func parseReverseIPv6(labels []string) (*Subnet, error) {
+	if len(labels) > 32 {
+		return nil, fmt.Errorf("too many labels in ip6.arpa name")
+	}
+
+	var netInt uint128.Uint128
+	for _, label := range labels {
+		nibble, err := strconv.ParseUint(label, 16, 4)
+		if err != nil || len(label) != 1 {
+			return nil, fmt.Errorf("invalid ip6.arpa label %q", label)
+		}
+		netInt = netInt.Lsh(4).Or64(nibble)
+	}
+
+	ones := uint8(len(labels) * 4)
+	return newSubnetFromInt(netInt.Lsh(uint(128-ones)), ones, true), nil
+}
+
+// ParseReverseName returns the address (as a /32 or /128) or the prefix of a
+// full or partial in-addr.arpa. or ip6.arpa. name. RFC 2317 labels like
+// "0-63" or "0/26" are accepted as the fourth IPv4 octet.
+func ParseReverseName(name string) (*Subnet, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	for _, isIPv6 := range []bool{false, true} {
+		suffix := strings.TrimSuffix(reverseSuffix(isIPv6), ".")
+		if name != suffix && !strings.HasSuffix(name, "."+suffix) {
+			continue
+		}
+
+		labels := []string{}
+		if name != suffix {
+			labels = strings.Split(strings.TrimSuffix(name, "."+suffix), ".")
+		}
+
+		// Most significant label first.
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+
+		if isIPv6 {
+			return parseReverseIPv6(labels)
+		}
+		return parseReverseIPv4(labels)
+	}
+
+	return nil, fmt.Errorf("%q is not an in-addr.arpa. or ip6.arpa. name", name)
+}
+
+// ParseReverseAddress returns the address of a full PTR owner name.
+func ParseReverseAddress(name string) (net.IP, error) {
+	s, err := ParseReverseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.IsHostAddress() {
+		return nil, fmt.Errorf("%q is not the name of a single address", name)
+	}
+
+	return s.GetNetwork(), nil
+}
@@ -0,0 +1,219 @@
+package ipcalc
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	var tests = []struct {
+		ip, want string
+	}{
+		{"1.2.3.4", "4.3.2.1.in-addr.arpa."},
+		{"0.0.0.0", "0.0.0.0.in-addr.arpa."},
+		{"2001:db8::567:89ab", "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+
+	for _, tt := range tests {
+		if got := ReverseName(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestReverseZones(t *testing.T) {
+	var tests = []struct {
+		cidr, want string
+	}{
+		{"0.0.0.0/0", "in-addr.arpa."},
+		{"10.0.0.0/8", "10.in-addr.arpa."},
+		{"172.16.0.0/15", "16.172.in-addr.arpa. 17.172.in-addr.arpa."},
+		{"192.168.0.0/23", "0.168.192.in-addr.arpa. 1.168.192.in-addr.arpa."},
+		{"192.0.2.0/24", "2.0.192.in-addr.arpa."},
+		{"192.0.2.64/26", "64-127.2.0.192.in-addr.arpa."},
+		{"192.0.2.0/25", "0-127.2.0.192.in-addr.arpa."},
+		{"192.0.2.6/31", "6-7.2.0.192.in-addr.arpa."},
+		{"192.0.2.5/32", "5.2.0.192.in-addr.arpa."},
+		{"::/0", "ip6.arpa."},
+		{"2001:db8::/32", "8.b.d.0.1.0.0.2.ip6.arpa."},
+		{"2001:db8::/30", "8.b.d.0.1.0.0.2.ip6.arpa. 9.b.d.0.1.0.0.2.ip6.arpa. a.b.d.0.1.0.0.2.ip6.arpa. b.b.d.0.1.0.0.2.ip6.arpa."},
+		{"2001:db8:1234::/46", "4.3.2.1.8.b.d.0.1.0.0.2.ip6.arpa. 5.3.2.1.8.b.d.0.1.0.0.2.ip6.arpa. 6.3.2.1.8.b.d.0.1.0.0.2.ip6.arpa. 7.3.2.1.8.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(NewSubnet(tt.cidr).ReverseZones(), " ")
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.cidr, got, tt.want)
+		}
+	}
+
+	if got := len(NewSubnet("10.0.0.0/9").ReverseZones()); got != 128 {
+		t.Errorf("got %d zones for a /9, want 128", got)
+	}
+}
+
+func TestWritePTRZone(t *testing.T) {
+	root := NewSubnet("192.0.2.0/24")
+	for _, host := range []struct{ cidr, name string }{
+		{"192.0.2.1/32", "gw.example.com"},
+		{"192.0.2.10/32", "db.example.com."},
+		{"192.0.2.70/32", "web.example.com"},
+		{"192.0.2.71/32", ""},
+		{"192.0.2.64/26", "dmz"},
+	} {
+		s := NewSubnet(host.cidr)
+		s.Meta = host.name
+		root.Insert(s)
+	}
+
+	opts := PTRZoneOptions{
+		PrimaryNS:  "ns1.example.com",
+		Hostmaster: "hostmaster.example.com",
+		Serial:     2024010101,
+	}
+
+	b := &strings.Builder{}
+	if err := root.WritePTRZone(b, "2.0.192.in-addr.arpa.", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `$ORIGIN 2.0.192.in-addr.arpa.
+$TTL 3600
+@	IN	SOA	ns1.example.com. hostmaster.example.com. 2024010101 3600 600 604800 3600
+@	IN	NS	ns1.example.com.
+1	IN	PTR	gw.example.com.
+10	IN	PTR	db.example.com.
+70	IN	PTR	web.example.com.
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	dmz, _ := root.Find(NewSubnet("192.0.2.64/26"))
+	b.Reset()
+	opts.NameServers = []string{"ns1.example.com", "ns2.example.com."}
+	if err := dmz.WritePTRZone(b, "64-127.2.0.192.in-addr.arpa", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want = `$ORIGIN 64-127.2.0.192.in-addr.arpa.
+$TTL 3600
+@	IN	SOA	ns1.example.com. hostmaster.example.com. 2024010101 3600 600 604800 3600
+@	IN	NS	ns1.example.com.
+@	IN	NS	ns2.example.com.
+70	IN	PTR	web.example.com.
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	if err := dmz.WritePTRZone(b, "2.0.192.in-addr.arpa.", opts); err == nil {
+		t.Errorf("writing a zone not belonging to the subnet should fail")
+	}
+
+	if err := root.WritePTRZone(b, "2.0.192.in-addr.arpa.", PTRZoneOptions{}); err == nil {
+		t.Errorf("writing a zone without a primary name server should fail")
+	}
+}
+
+func TestWritePTRZoneIPv6(t *testing.T) {
+	root := NewSubnet("2001:db8:1::/48")
+	host := NewSubnet("2001:db8:1::53/128")
+	host.Meta = "ns.example.com"
+	root.Insert(host)
+
+	b := &strings.Builder{}
+	err := root.WritePTRZone(b, "1.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", PTRZoneOptions{
+		PrimaryNS:  "ns.example.com.",
+		Hostmaster: "hostmaster.example.com.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), "\n3.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0\tIN\tPTR\tns.example.com.\n") {
+		t.Errorf("missing PTR record in\n%s", b)
+	}
+}
+
+func TestParseReverseName(t *testing.T) {
+	var tests = []struct {
+		name, want string
+	}{
+		{"4.3.2.1.in-addr.arpa.", "1.2.3.4/32"},
+		{"4.3.2.1.IN-ADDR.ARPA", "1.2.3.4/32"},
+		{"2.0.192.in-addr.arpa.", "192.0.2.0/24"},
+		{"10.in-addr.arpa", "10.0.0.0/8"},
+		{"in-addr.arpa.", "0.0.0.0/0"},
+		{"0-63.2.0.192.in-addr.arpa", "192.0.2.0/26"},
+		{"64-127.2.0.192.in-addr.arpa.", "192.0.2.64/26"},
+		{"128/25.2.0.192.in-addr.arpa.", "192.0.2.128/25"},
+		{"6-7.2.0.192.in-addr.arpa.", "192.0.2.6/31"},
+		{"70.64-127.2.0.192.in-addr.arpa.", "192.0.2.70/32"},
+		{"b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "2001:db8::567:89ab/128"},
+		{"8.b.d.0.1.0.0.2.ip6.arpa.", "2001:db8::/32"},
+		{"1.0.0.2.IP6.ARPA", "2001::/16"},
+		{"ip6.arpa", "::/0"},
+
+		{"5.4.3.2.1.in-addr.arpa.", ""},
+		{"256.2.0.192.in-addr.arpa.", ""},
+		{"01.2.0.192.in-addr.arpa.", ""},
+		{"0-64.2.0.192.in-addr.arpa.", ""},
+		{"32-95.2.0.192.in-addr.arpa.", ""},
+		{"63-0.2.0.192.in-addr.arpa.", ""},
+		{"0-255.2.0.192.in-addr.arpa.", ""},
+		{"0/24.2.0.192.in-addr.arpa.", ""},
+		{"64/25.2.0.192.in-addr.arpa.", ""},
+		{"70.0-63.2.0.192.in-addr.arpa.", ""},
+		{"0-63.2.0.in-addr.arpa.", ""},
+		{"ab.8.b.d.0.1.0.0.2.ip6.arpa.", ""},
+		{"g.8.b.d.0.1.0.0.2.ip6.arpa.", ""},
+		{"example.com.", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseReverseName(tt.name)
+		if err != nil {
+			if tt.want != "" {
+				t.Errorf("%s: %v, want %s", tt.name, err, tt.want)
+			}
+			continue
+		}
+
+		if tt.want == "" {
+			t.Errorf("%s: got %s, wanted failure", tt.name, got.GetCidr())
+			continue
+		}
+
+		if got.GetCidr() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got.GetCidr(), tt.want)
+		}
+	}
+}
+
+func TestParseReverseRoundTrip(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		for _, s := range []*Subnet{NewSubnet(randIPv4Subnet()), NewSubnet(randIPv6Subnet())} {
+			for _, zone := range s.ReverseZones() {
+				got, err := ParseReverseName(zone)
+				if err != nil {
+					t.Fatalf("%s: %v", zone, err)
+				}
+				if !got.Covers(s) && !s.Covers(got) {
+					t.Fatalf("%s: got %s, which is unrelated to %s", zone, got.GetCidr(), s.GetCidr())
+				}
+			}
+		}
+
+		ip := net.ParseIP(randIPv6Addr())
+		got, err := ParseReverseAddress(ReverseName(ip))
+		if err != nil || !got.Equal(ip) {
+			t.Fatalf("%s: got %s %v", ip, got, err)
+		}
+	}
+
+	if _, err := ParseReverseAddress("2.0.192.in-addr.arpa."); err == nil {
+		t.Errorf("parsing a zone name as an address should fail")
+	}
+}
@@ -0,0 +1,451 @@
+package ipcalc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type NextHop struct {
+	Gateway net.IP
+	Device  string
+	Weight  uint32 // 0 counts as 1
+}
+
+func (n NextHop) String() string {
+	parts := []string{}
+	if n.Gateway != nil {
+		parts = append(parts, "via "+n.Gateway.String())
+	}
+	if n.Device != "" {
+		parts = append(parts, "dev "+n.Device)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (n NextHop) weight() uint32 {
+	if n.Weight == 0 {
+		return 1
+	}
+
+	return n.Weight
+}
+
+// Route is a route to Prefix. Routes of the same prefix are ranked by their
+// administrative distance first and their metric second; routes ranked equal
+// form an ECMP group together with all of their next hops.
+type Route struct {
+	Prefix   *Subnet
+	Type     string // unicast, blackhole, unreachable, prohibit, ...
+	NextHops []NextHop
+	Metric   uint32
+	Distance uint8
+	Protocol string // kernel, static, dhcp, bgp, ...
+	Source   net.IP // preferred source address
+}
+
+func (r *Route) String() string {
+	parts := []string{}
+	if r.Type != "" && r.Type != "unicast" {
+		parts = append(parts, r.Type)
+	}
+	parts = append(parts, r.Prefix.GetCidr())
+	for _, nh := range r.NextHops {
+		parts = append(parts, nh.String())
+	}
+	if r.Protocol != "" {
+		parts = append(parts, "proto "+r.Protocol)
+	}
+	parts = append(parts, fmt.Sprintf("metric %d", r.Metric))
+
+	return strings.Join(parts, " ")
+}
+
+func (r *Route) isUnicast() bool {
+	return r.Type == "" || r.Type == "unicast"
+}
+
+func (r *Route) better(r2 *Route) bool {
+	if r.Distance != r2.Distance {
+		return r.Distance < r2.Distance
+	}
+
+	return r.Metric < r2.Metric
+}
+
+func (r *Route) equal(r2 *Route) bool {
+	return r.Distance == r2.Distance && r.Metric == r2.Metric
+}
+
+type RoutingTable struct {
+	table  *Table
+	routes map[*Subnet][]*Route
+}
+
+func NewRoutingTable() *RoutingTable {
+	return &RoutingTable{
+		table:  NewTable(),
+		routes: map[*Subnet][]*Route{},
+	}
+}
+
+func (t *RoutingTable) Add(r *Route) error {
+	if r.Prefix == nil {
+		return fmt.Errorf("route without prefix")
+	}
+
+	// IPv4 routes can have IPv6 gateways (RFC 5549), but not the other way.
+	for _, nh := range r.NextHops {
+		if nh.Gateway != nil && r.Prefix.isIPv6 && !newHostSubnet(nh.Gateway).isIPv6 {
+			return fmt.Errorf("gateway %s of %s is an ipv4 address", nh.Gateway, r.Prefix.GetCidr())
+		}
+	}
+
+	node, err := t.table.insertOrFind(r.Prefix)
+	if err != nil {
+		return err
+	}
+	t.routes[node] = append(t.routes[node], r)
+
+	return nil
+}
+
+// Routes returns every route in prefix order.
+func (t *RoutingTable) Routes() []*Route {
+	res := []*Route{}
+	t.table.Walk(func(node *Subnet) bool {
+		res = append(res, t.routes[node]...)
+		return true
+	})
+
+	return res
+}
+
+// Lookup returns the winning routes for ip: the best ranked routes of the
+// longest matching prefix. More than one route means ECMP.
+func (t *RoutingTable) Lookup(ip net.IP) ([]*Route, error) {
+	node, err := t.table.LookupIP(ip)
+	if err != nil {
+		return nil, fmt.Errorf("no route to %s", ip)
+	}
+
+	res := []*Route{}
+	for _, r := range t.routes[node] {
+		switch {
+		case len(res) == 0 || r.better(res[0]):
+			res = []*Route{r}
+		case r.equal(res[0]):
+			res = append(res, r)
+		}
+	}
+
+	return res, nil
+}
+
+// FlowHash hashes the 5-tuple of a packet, so every packet of a flow takes
+// the same ECMP next hop.
+func FlowHash(p Packet) uint32 {
+	h := fnv.New32a()
+	h.Write(p.Src.To16())
+	h.Write(p.Dst.To16())
+
+	b := make([]byte, 5)
+	b[0] = byte(p.Protocol)
+	binary.BigEndian.PutUint16(b[1:], p.SrcPort)
+	binary.BigEndian.PutUint16(b[3:], p.DstPort)
+	h.Write(b)
+
+	return h.Sum32()
+}
+
+// SelectNextHop picks one next hop of the routes by weight, based on the
+// flow hash.
+func SelectNextHop(routes []*Route, flowHash uint32) (NextHop, error) {
+	total := uint64(0)
+	for _, r := range routes {
+		for _, nh := range r.NextHops {
+			total += uint64(nh.weight())
+		}
+	}
+
+	if total == 0 {
+		return NextHop{}, fmt.Errorf("no next hop")
+	}
+
+	// The low bits of FNV are weak, scale the hash instead of using modulo.
+	pick := uint64(flowHash) * total >> 32
+	for _, r := range routes {
+		for _, nh := range r.NextHops {
+			if pick < uint64(nh.weight()) {
+				return nh, nil
+			}
+			pick -= uint64(nh.weight())
+		}
+	}
+
+	return NextHop{}, fmt.Errorf("no next hop")
+}
+
+// Forward simulates the forwarding decision for a packet.
+func (t *RoutingTable) Forward(p Packet) (*Route, NextHop, error) {
+	routes, err := t.Lookup(p.Dst)
+	if err != nil {
+		return nil, NextHop{}, err
+	}
+
+	unicast := []*Route{}
+	for _, r := range routes {
+		if r.isUnicast() {
+			unicast = append(unicast, r)
+		}
+	}
+
+	if len(unicast) == 0 {
+		return routes[0], NextHop{}, fmt.Errorf("%s is %s", p.Dst, routes[0].Type)
+	}
+
+	nh, err := SelectNextHop(unicast, FlowHash(p))
+	if err != nil {
+		return nil, NextHop{}, err
+	}
+
+	for _, r := range unicast {
+		for _, candidate := range r.NextHops {
+			if candidate.Device == nh.Device && candidate.Gateway.Equal(nh.Gateway) {
+				return r, nh, nil
+			}
+		}
+	}
+
+	return unicast[0], nh, nil
+}
+
+// parseRoutePrefix parses the dst of ip route, where "default" depends on the
+// address family and a missing prefix length means a host route.
+func parseRoutePrefix(dst string, isIPv6 bool) (*Subnet, error) {
+	if dst == "default" {
+		if isIPv6 {
+			return NewSubnet("::/0"), nil
+		}
+		return NewSubnet("0.0.0.0/0"), nil
+	}
+
+	return parseSubnetOrHost(dst)
+}
+
+var ipRouteTypes = map[string]bool{
+	"unicast":     true,
+	"local":       true,
+	"broadcast":   true,
+	"multicast":   true,
+	"throw":       true,
+	"unreachable": true,
+	"prohibit":    true,
+	"blackhole":   true,
+	"nat":         true,
+	"anycast":     true,
+}
+
+var ipRouteFlags = map[string]bool{
+	"onlink":    true,
+	"linkdown":  true,
+	"dead":      true,
+	"pervasive": true,
+	"offload":   true,
+	"trap":      true,
+}
+
+// parseIPRouteAttributes applies the "key value" attributes of a route or
+// of a nexthop line. Unknown attributes are skipped.
+func parseIPRouteAttributes(r *Route, nh *NextHop, fields []string) error {
+	for i := 0; i < len(fields); i++ {
+		if ipRouteFlags[fields[i]] {
+			continue
+		}
+
+		if i+1 >= len(fields) {
+			return fmt.Errorf("missing value for %s", fields[i])
+		}
+		key, value := fields[i], fields[i+1]
+		i++
+
+		var err error
+		switch key {
+		case "via":
+			// "via inet6 fe80::1" is used for IPv4 routes with IPv6
+			// gateways, the family does not change the family of the route.
+			if (value == "inet" || value == "inet6") && i+1 < len(fields) {
+				i++
+				value = fields[i]
+			}
+			if nh.Gateway = net.ParseIP(value); nh.Gateway == nil {
+				err = fmt.Errorf("invalid gateway %q", value)
+			}
+		case "dev":
+			nh.Device = value
+		case "weight":
+			var weight uint64
+			weight, err = strconv.ParseUint(value, 10, 32)
+			nh.Weight = uint32(weight)
+		case "proto":
+			r.Protocol = value
+		case "src":
+			r.Source = net.ParseIP(value)
+		case "metric":
+			var metric uint64
+			metric, err = strconv.ParseUint(value, 10, 32)
+			r.Metric = uint32(metric)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadIPRoute reads the text output of "ip route show" (or "ip -6 route").
+// isIPv6 is the address family of "default" routes.
+func ReadIPRoute(reader io.Reader, isIPv6 bool) (*RoutingTable, error) {
+	t := NewRoutingTable()
+	var last *Route
+
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		text := scanner.Text()
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "nexthop" {
+			if last == nil {
+				return nil, fmt.Errorf("line %d: nexthop without route", lineNum)
+			}
+
+			nh := NextHop{}
+			if err := parseIPRouteAttributes(last, &nh, fields[1:]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			last.NextHops = append(last.NextHops, nh)
+			continue
+		}
+
+		r := &Route{Type: "unicast"}
+		if ipRouteTypes[fields[0]] {
+			r.Type = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: route without prefix", lineNum)
+		}
+
+		nh := NextHop{}
+		if err := parseIPRouteAttributes(r, &nh, fields[1:]); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if nh.Gateway != nil || nh.Device != "" {
+			r.NextHops = append(r.NextHops, nh)
+		}
+
+		prefix, err := parseRoutePrefix(fields[0], isIPv6)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		r.Prefix = prefix
+
+		if err := t.Add(r); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		last = r
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+type ipRouteJSONNextHop struct {
+	Gateway string `json:"gateway"`
+	Dev     string `json:"dev"`
+	Weight  uint32 `json:"weight"`
+}
+
+type ipRouteJSON struct {
+	ipRouteJSONNextHop
+	Type     string               `json:"type"`
+	Dst      string               `json:"dst"`
+	Protocol string               `json:"protocol"`
+	PrefSrc  string               `json:"prefsrc"`
+	Metric   uint32               `json:"metric"`
+	NextHops []ipRouteJSONNextHop `json:"nexthops"`
+}
+
+func (j ipRouteJSONNextHop) nextHop() (NextHop, error) {
+	nh := NextHop{Device: j.Dev, Weight: j.Weight}
+	if j.Gateway != "" {
+		if nh.Gateway = net.ParseIP(j.Gateway); nh.Gateway == nil {
+			return nh, fmt.Errorf("invalid gateway %q", j.Gateway)
+		}
+	}
+
+	return nh, nil
+}
+
+// ReadIPRouteJSON reads the output of "ip -j route show". isIPv6 is the
+// address family of "default" routes.
+func ReadIPRouteJSON(reader io.Reader, isIPv6 bool) (*RoutingTable, error) {
+	var entries []ipRouteJSON
+	if err := json.NewDecoder(reader).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	t := NewRoutingTable()
+	for i, entry := range entries {
+		r := &Route{
+			Type:     entry.Type,
+			Protocol: entry.Protocol,
+			Metric:   entry.Metric,
+			Source:   net.ParseIP(entry.PrefSrc),
+		}
+		if r.Type == "" {
+			r.Type = "unicast"
+		}
+
+		for _, j := range append([]ipRouteJSONNextHop{entry.ipRouteJSONNextHop}, entry.NextHops...) {
+			if j.Gateway == "" && j.Dev == "" {
+				continue
+			}
+
+			nh, err := j.nextHop()
+			if err != nil {
+				return nil, fmt.Errorf("route %d: %v", i, err)
+			}
+			r.NextHops = append(r.NextHops, nh)
+		}
+
+		prefix, err := parseRoutePrefix(entry.Dst, isIPv6)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+		r.Prefix = prefix
+
+		if err := t.Add(r); err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,201 @@
+package ipcalc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testIPRoute = `default via 192.168.1.1 dev eth0 proto dhcp src 192.168.1.50 metric 100
+default via 192.168.1.254 dev eth1 proto static metric 200
+10.0.0.0/8 proto bgp metric 20
+	nexthop via 192.168.1.2 dev eth0 weight 1
+	nexthop via 192.168.1.3 dev eth0 weight 3
+blackhole 10.66.0.0/16 proto static
+192.168.1.0/24 dev eth0 proto kernel scope link src 192.168.1.50
+192.168.1.77 via 192.168.1.7 dev eth0 onlink
+`
+
+func TestReadIPRoute(t *testing.T) {
+	table, err := ReadIPRoute(strings.NewReader(testIPRoute), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := table.Routes()
+	if len(routes) != 6 {
+		t.Fatalf("got %d routes, want 6", len(routes))
+	}
+
+	var tests = []struct {
+		dst, want string
+	}{
+		{"8.8.8.8", "0.0.0.0/0 via 192.168.1.1 dev eth0 proto dhcp metric 100"},
+		{"10.1.2.3", "10.0.0.0/8 via 192.168.1.2 dev eth0 via 192.168.1.3 dev eth0 proto bgp metric 20"},
+		{"10.66.1.1", "blackhole 10.66.0.0/16 proto static metric 0"},
+		{"192.168.1.20", "192.168.1.0/24 dev eth0 proto kernel metric 0"},
+		{"192.168.1.77", "192.168.1.77/32 via 192.168.1.7 dev eth0 metric 0"},
+	}
+
+	for _, tt := range tests {
+		got, err := table.Lookup(net.ParseIP(tt.dst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].String() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.dst, got, tt.want)
+		}
+	}
+
+	if got := routes[0].Source.String(); got != "192.168.1.50" {
+		t.Errorf("got source %s, want 192.168.1.50", got)
+	}
+
+	if _, err := table.Lookup(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestReadIPRouteErrors(t *testing.T) {
+	for _, input := range []string{
+		"\tnexthop via 10.0.0.1 dev eth0\n",
+		"10.0.0.0/8 via 10.0.0.1.1 dev eth0\n",
+		"2001:db8::/32 via 10.0.0.1 dev eth0\n",
+		"10.0.0.0/33 dev eth0\n",
+		"10.0.0.0/8 dev\n",
+		"blackhole\n",
+	} {
+		if _, err := ReadIPRoute(strings.NewReader(input), false); err == nil {
+			t.Errorf("%q: got nil error, wanted failure", input)
+		}
+	}
+}
+
+func TestReadIPRouteIPv6Gateway(t *testing.T) {
+	input := "default via inet6 fe80::1 dev eth0\n10.0.0.0/8 via inet6 fe80::2 dev eth1\n"
+	table, err := ReadIPRoute(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		dst, want string
+	}{
+		{"8.8.8.8", "0.0.0.0/0 via fe80::1 dev eth0 metric 0"},
+		{"10.1.2.3", "10.0.0.0/8 via fe80::2 dev eth1 metric 0"},
+	}
+
+	for _, tt := range tests {
+		got, err := table.Lookup(net.ParseIP(tt.dst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].String() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.dst, got, tt.want)
+		}
+	}
+
+	if _, err := table.Lookup(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestReadIPRouteJSON(t *testing.T) {
+	input := `[
+		{"dst":"default","gateway":"fe80::1","dev":"eth0","protocol":"ra","metric":1024,"flags":[]},
+		{"dst":"2001:db8:1::/48","protocol":"static","metric":10,"nexthops":[
+			{"gateway":"fe80::2","dev":"eth0","weight":1,"flags":[]},
+			{"gateway":"fe80::3","dev":"eth1","weight":1,"flags":[]}]},
+		{"type":"unreachable","dst":"2001:db8:dead::/48","dev":"lo","metric":1024},
+		{"dst":"2001:db8:2::/64","dev":"eth0","protocol":"kernel","metric":256,"flags":[]}
+	]`
+
+	table, err := ReadIPRouteJSON(strings.NewReader(input), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		dst, want string
+	}{
+		{"2001:db9::1", "::/0 via fe80::1 dev eth0 proto ra metric 1024"},
+		{"2001:db8:1::1", "2001:db8:1::/48 via fe80::2 dev eth0 via fe80::3 dev eth1 proto static metric 10"},
+		{"2001:db8:dead::1", "unreachable 2001:db8:dead::/48 dev lo metric 1024"},
+		{"2001:db8:2::1", "2001:db8:2::/64 dev eth0 proto kernel metric 256"},
+	}
+
+	for _, tt := range tests {
+		got, err := table.Lookup(net.ParseIP(tt.dst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].String() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.dst, got, tt.want)
+		}
+	}
+
+	if _, err := ReadIPRouteJSON(strings.NewReader(`[{"dst":"2001:db8::/129"}]`), true); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestRoutingTableRanking(t *testing.T) {
+	table := NewRoutingTable()
+	for _, r := range []*Route{
+		{Prefix: NewSubnet("10.0.0.0/8"), NextHops: []NextHop{{Device: "eth0"}}, Distance: 20, Metric: 5},
+		{Prefix: NewSubnet("10.0.0.0/8"), NextHops: []NextHop{{Device: "eth1"}}, Distance: 1, Metric: 10},
+		{Prefix: NewSubnet("10.0.0.0/8"), NextHops: []NextHop{{Device: "eth2"}}, Distance: 1, Metric: 10},
+		{Prefix: NewSubnet("10.0.0.0/8"), NextHops: []NextHop{{Device: "eth3"}}, Distance: 1, Metric: 20},
+	} {
+		if err := table.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := table.Lookup(net.ParseIP("10.1.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].NextHops[0].Device != "eth1" || got[1].NextHops[0].Device != "eth2" {
+		t.Errorf("got %v, want the routes via eth1 and eth2", got)
+	}
+
+	if err := table.Add(&Route{Prefix: NewSubnet("2001:db8::/32"), NextHops: []NextHop{{Gateway: net.ParseIP("10.0.0.1")}}}); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestForwardECMP(t *testing.T) {
+	table, err := ReadIPRoute(strings.NewReader(testIPRoute), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		p := Packet{net.ParseIP(fmt.Sprintf("172.16.%d.%d", i/256, i%256)), net.ParseIP("10.1.2.3"), ProtocolTCP, uint16(1024 + i), 443}
+		r, nh, err := table.Forward(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Prefix.GetCidr() != "10.0.0.0/8" {
+			t.Fatalf("got route %s, want 10.0.0.0/8", r)
+		}
+		counts[nh.Gateway.String()]++
+
+		// The same flow must always take the same next hop.
+		if _, again, _ := table.Forward(p); !again.Gateway.Equal(nh.Gateway) {
+			t.Fatalf("flow %v changed next hop", p)
+		}
+	}
+
+	// Weights 1 and 3.
+	if counts["192.168.1.2"] < 700 || counts["192.168.1.2"] > 1300 || counts["192.168.1.3"] < 2700 {
+		t.Errorf("got counts %v, want about 1:3", counts)
+	}
+
+	if _, _, err := table.Forward(Packet{Dst: net.ParseIP("10.66.0.1")}); err == nil || !strings.Contains(err.Error(), "blackhole") {
+		t.Errorf("got error %v, want blackhole", err)
+	}
+}
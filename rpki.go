@@ -0,0 +1,187 @@
+package ipcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ROA is a Validated ROA Payload: ASN may originate Prefix and its more
+// specifics up to MaxLength.
+type ROA struct {
+	Prefix    *Subnet
+	MaxLength uint8
+	ASN       uint32
+	TA        string // trust anchor
+}
+
+func (roa *ROA) String() string {
+	return fmt.Sprintf("%s-%d AS%d", roa.Prefix.GetCidr(), roa.MaxLength, roa.ASN)
+}
+
+// Matches reports whether roa authorizes the announcement. ROAs of AS0
+// never match anything (RFC 6483).
+func (roa *ROA) Matches(prefix *Subnet, originAS uint32) bool {
+	return roa.ASN != 0 && roa.ASN == originAS && roa.Prefix.Covers(prefix) && prefix.NetOnes <= roa.MaxLength
+}
+
+type ValidationState uint8
+
+const (
+	NotFound ValidationState = iota
+	Valid
+	Invalid
+)
+
+func (v ValidationState) String() string {
+	switch v {
+	case NotFound:
+		return "NotFound"
+	case Valid:
+		return "Valid"
+	case Invalid:
+		return "Invalid"
+	}
+
+	return fmt.Sprintf("ValidationState(%d)", uint8(v))
+}
+
+// Validation is the result of route origin validation. Covering are all
+// ROAs covering the announced prefix, Matched the ones authorizing it.
+type Validation struct {
+	State    ValidationState
+	Covering []*ROA
+	Matched  []*ROA
+}
+
+// ROV is a route origin validator (RFC 6811).
+type ROV struct {
+	table *Table
+	roas  map[*Subnet][]*ROA
+	count int
+}
+
+func NewROV() *ROV {
+	return &ROV{
+		table: NewTable(),
+		roas:  map[*Subnet][]*ROA{},
+	}
+}
+
+func (v *ROV) Add(roa *ROA) error {
+	if roa.Prefix == nil {
+		return fmt.Errorf("roa without prefix")
+	}
+
+	if roa.MaxLength < roa.Prefix.NetOnes || roa.MaxLength > roa.Prefix.totalNumberOfBits() {
+		return fmt.Errorf("invalid max length %d of %s", roa.MaxLength, roa.Prefix.GetCidr())
+	}
+
+	node, err := v.table.insertOrFind(roa.Prefix)
+	if err != nil {
+		return err
+	}
+	v.roas[node] = append(v.roas[node], roa)
+	v.count++
+
+	return nil
+}
+
+// Len returns the number of ROAs.
+func (v *ROV) Len() int {
+	return v.count
+}
+
+// Validate classifies the announcement of prefix by originAS. Use 0 as the
+// origin of routes without a single origin AS, like ones ending in an AS_SET,
+// these are never Valid.
+func (v *ROV) Validate(prefix *Subnet, originAS uint32) Validation {
+	res := Validation{State: NotFound}
+	for _, node := range v.table.Covering(prefix) {
+		for _, roa := range v.roas[node] {
+			res.Covering = append(res.Covering, roa)
+			if roa.Matches(prefix, originAS) {
+				res.Matched = append(res.Matched, roa)
+			}
+		}
+	}
+
+	switch {
+	case len(res.Matched) > 0:
+		res.State = Valid
+	case len(res.Covering) > 0:
+		res.State = Invalid
+	}
+
+	return res
+}
+
+// ValidateCidr is like Validate with the prefix given as a string.
+func (v *ROV) ValidateCidr(cidr string, originAS uint32) (Validation, error) {
+	prefix := NewSubnet(cidr)
+	if prefix == nil {
+		return Validation{}, fmt.Errorf("could not parse cidr %q", cidr)
+	}
+
+	return v.Validate(prefix, originAS), nil
+}
+
+// parseASN parses 64500, "64500" and "AS64500".
+func parseASN(raw json.RawMessage) (uint32, error) {
+	str := strings.Trim(string(raw), `"`)
+	if len(str) > 2 && strings.EqualFold(str[:2], "AS") {
+		str = str[2:]
+	}
+
+	asn, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid asn %s", raw)
+	}
+
+	return uint32(asn), nil
+}
+
+type vrpJSON struct {
+	Prefix    string          `json:"prefix"`
+	MaxLength *uint8          `json:"maxLength"`
+	ASN       json.RawMessage `json:"asn"`
+	TA        string          `json:"ta"`
+}
+
+// ReadVRPJSON reads Validated ROA Payloads in the JSON format exported by
+// Routinator, rpki-client and others: {"roas": [{"prefix": "192.0.2.0/24",
+// "maxLength": 24, "asn": "AS64500", "ta": "ripe"}]}. A missing maxLength
+// means the length of the prefix.
+func ReadVRPJSON(r io.Reader) (*ROV, error) {
+	var doc struct {
+		ROAs []vrpJSON `json:"roas"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	v := NewROV()
+	for i, entry := range doc.ROAs {
+		roa := &ROA{Prefix: NewSubnet(entry.Prefix), TA: entry.TA}
+		if roa.Prefix == nil {
+			return nil, fmt.Errorf("roa %d: could not parse prefix %q", i, entry.Prefix)
+		}
+
+		roa.MaxLength = roa.Prefix.NetOnes
+		if entry.MaxLength != nil {
+			roa.MaxLength = *entry.MaxLength
+		}
+
+		var err error
+		if roa.ASN, err = parseASN(entry.ASN); err == nil {
+			err = v.Add(roa)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("roa %d: %v", i, err)
+		}
+	}
+
+	return v, nil
+}
@@ -0,0 +1,89 @@
+package ipcalc
+
+import (
+	"strings"
+	"testing"
+)
+
+const testVRPs = `{
+	"metadata": {"generated": 1700000000},
+	"roas": [
+		{"asn": "AS64500", "prefix": "192.0.2.0/24", "maxLength": 24, "ta": "test"},
+		{"asn": "AS64501", "prefix": "198.51.100.0/22", "maxLength": 24, "ta": "test"},
+		{"asn": 64502, "prefix": "198.51.100.0/24", "maxLength": 24, "ta": "test"},
+		{"asn": "AS0", "prefix": "203.0.113.0/24", "maxLength": 32, "ta": "test"},
+		{"asn": "AS64510", "prefix": "2001:db8::/32", "maxLength": 48, "ta": "test"},
+		{"asn": "AS64511", "prefix": "2001:db8:ffff::/48", "ta": "test"}
+	]
+}`
+
+func TestROVValidate(t *testing.T) {
+	rov, err := ReadVRPJSON(strings.NewReader(testVRPs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := rov.Len(); got != 6 {
+		t.Errorf("got %d ROAs, want 6", got)
+	}
+
+	var tests = []struct {
+		prefix       string
+		origin       uint32
+		want         ValidationState
+		wantCovering int
+		wantMatched  int
+	}{
+		{"192.0.2.0/24", 64500, Valid, 1, 1},
+		{"192.0.2.0/24", 64999, Invalid, 1, 0},
+		{"192.0.2.0/25", 64500, Invalid, 1, 0},  // too specific
+		{"192.0.0.0/16", 64500, NotFound, 0, 0}, // less specific is not covered
+		{"198.51.100.0/24", 64501, Valid, 2, 1},
+		{"198.51.100.0/24", 64502, Valid, 2, 1},
+		{"198.51.101.0/24", 64502, Invalid, 1, 0},
+		{"198.51.101.0/24", 64501, Valid, 1, 1},
+		{"198.51.100.0/22", 64501, Valid, 1, 1},
+		{"203.0.113.0/24", 0, Invalid, 1, 0},
+		{"203.0.113.128/25", 64500, Invalid, 1, 0},
+		{"10.0.0.0/8", 64500, NotFound, 0, 0},
+		{"2001:db8::/32", 64510, Valid, 1, 1},
+		{"2001:db8:1::/48", 64510, Valid, 1, 1},
+		{"2001:db8:1::/49", 64510, Invalid, 1, 0},
+		{"2001:db8:ffff::/48", 64511, Valid, 2, 1},
+		{"2001:db8:ffff::/48", 64510, Valid, 2, 1},
+		{"2001:db8:ffff::/56", 64511, Invalid, 2, 0},
+		{"2001:db9::/32", 64510, NotFound, 0, 0},
+	}
+
+	for _, tt := range tests {
+		got, err := rov.ValidateCidr(tt.prefix, tt.origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.State != tt.want || len(got.Covering) != tt.wantCovering || len(got.Matched) != tt.wantMatched {
+			t.Errorf("%s AS%d: got %s covering %v matched %v, want %s %d %d",
+				tt.prefix, tt.origin, got.State, got.Covering, got.Matched, tt.want, tt.wantCovering, tt.wantMatched)
+		}
+	}
+
+	got, _ := rov.ValidateCidr("198.51.100.0/24", 64502)
+	if got.Covering[0].String() != "198.51.100.0/22-24 AS64501" || got.Matched[0].String() != "198.51.100.0/24-24 AS64502" {
+		t.Errorf("got covering %v matched %v, want AS64501 and AS64502", got.Covering, got.Matched)
+	}
+}
+
+func TestReadVRPJSONErrors(t *testing.T) {
+	for _, input := range []string{
+		`{"roas": [{"asn": "AS64500", "prefix": "192.0.2.0/33", "maxLength": 24}]}`,
+		`{"roas": [{"asn": "AS64500", "prefix": "192.0.2.0/24", "maxLength": 23}]}`,
+		`{"roas": [{"asn": "AS64500", "prefix": "192.0.2.0/24", "maxLength": 33}]}`,
+		`{"roas": [{"asn": "ASX", "prefix": "192.0.2.0/24", "maxLength": 24}]}`,
+		`{"roas": [{"asn": 4294967296, "prefix": "192.0.2.0/24", "maxLength": 24}]}`,
+		`{"roas": [`,
+	} {
+		if _, err := ReadVRPJSON(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: got nil error, wanted failure", input)
+		}
+	}
+}
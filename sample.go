@@ -0,0 +1,169 @@
+package ipcalc
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+
+	"github.com/vrgakos/uint128"
+)
+
+// SampleOptions leave addresses out of random sampling. Left out addresses
+// are drawn again, so the result stays uniform over the remaining ones.
+type SampleOptions struct {
+	// HostsOnly leaves out the addresses of subnets which are not usable
+	// hosts, see HostRange. Ranges do not have such addresses.
+	HostsOnly bool
+	// Exclude leaves out the addresses of these classes of the
+	// special-purpose registries, like ClassReserved|ClassMulticast.
+	Exclude AddressClass
+}
+
+// sampleAttempts limits the draws of an address which is not excluded.
+const sampleAttempts = 1000
+
+func randUint64(src rand.Source) uint64 {
+	if src64, ok := src.(rand.Source64); ok {
+		return src64.Uint64()
+	}
+
+	return uint64(src.Int63())>>31 | uint64(src.Int63())<<32
+}
+
+// randUint128 returns a uniform random number from 0 to last, both included.
+func randUint128(src rand.Source, last uint128.Uint128) uint128.Uint128 {
+	mask := uint128.Max.Rsh(uint(128 - last.Len()))
+	for {
+		lo := randUint64(src)
+		hi := uint64(0)
+		if last.Hi != 0 {
+			hi = randUint64(src)
+		}
+
+		if x := uint128.New(lo, hi).And(mask); x.Cmp(last) <= 0 {
+			return x
+		}
+	}
+}
+
+// sampleRanges draws a uniform random address from disjoint ranges of the
+// same family.
+func sampleRanges(src rand.Source, ranges []*Range, exclude AddressClass) (net.IP, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no addresses to sample from")
+	}
+
+	// The ranges are disjoint, the total size minus one always fits.
+	last := ranges[0].Size.Last()
+	for _, r := range ranges[1:] {
+		last = last.Add(r.Size.Last()).Add64(1)
+	}
+
+	for i := 0; i < sampleAttempts; i++ {
+		x := randUint128(src, last)
+		for _, r := range ranges {
+			if x.Cmp(r.Size.Last()) <= 0 {
+				ip := r.GetIpByOffset(x)
+				if exclude == 0 || !Classify(ip).Is(exclude) {
+					return ip, nil
+				}
+				break
+			}
+			x = x.Sub(r.Size.Last()).Sub64(1)
+		}
+	}
+
+	return nil, fmt.Errorf("no address found after %d attempts, most addresses are excluded", sampleAttempts)
+}
+
+// RandomIP returns a uniform random address of r.
+func (r *Range) RandomIP(src rand.Source, opts SampleOptions) (net.IP, error) {
+	return sampleRanges(src, []*Range{r}, opts.Exclude)
+}
+
+func (s *Subnet) sampleRange(opts SampleOptions) *Range {
+	if opts.HostsOnly {
+		return s.HostRange()
+	}
+
+	return s.Range()
+}
+
+// RandomIP returns a uniform random address of s.
+func (s *Subnet) RandomIP(src rand.Source, opts SampleOptions) (net.IP, error) {
+	return sampleRanges(src, []*Range{s.sampleRange(opts)}, opts.Exclude)
+}
+
+// RandomIP returns a uniform random address of the members of the set, nested
+// members do not make their addresses more likely.
+func (set *IPSet) RandomIP(src rand.Source, opts SampleOptions) (net.IP, error) {
+	ranges := []*Range{}
+	root := set.members.ipv4
+	if set.IPv6 {
+		root = set.members.ipv6
+	}
+
+	var visit func(n *Subnet)
+	visit = func(n *Subnet) {
+		if n == nil {
+			return
+		}
+		if !n.isDummy {
+			ranges = append(ranges, n.sampleRange(opts))
+			return
+		}
+		for _, child := range n.children {
+			visit(child)
+		}
+	}
+	visit(root)
+
+	return sampleRanges(src, ranges, opts.Exclude)
+}
+
+// subnetsLast returns the number of /ones subnets of a /blockOnes block
+// minus one, like RangeSize.Last.
+func subnetsLast(blockOnes, ones uint8) uint128.Uint128 {
+	return uint128.Max.Rsh(uint(128 - (ones - blockOnes)))
+}
+
+// RandomSubnet returns a uniform random aligned subnet of length ones in s,
+// which does not overlap any node below s.
+func (s *Subnet) RandomSubnet(src rand.Source, ones uint8) (*Subnet, error) {
+	if ones < s.NetOnes || ones > s.totalNumberOfBits() {
+		return nil, fmt.Errorf("invalid prefix length %d for %s", ones, s.GetCidr())
+	}
+
+	// Every free block of ones or less holds 2^(ones - its length) subnets.
+	blocks := []*Subnet{}
+	var last uint128.Uint128
+	s.walkFree(func(block *Subnet) {
+		if block.NetOnes > ones {
+			return
+		}
+
+		count := subnetsLast(block.NetOnes, ones)
+		if len(blocks) == 0 {
+			last = count
+		} else {
+			last = last.Add(count).Add64(1)
+		}
+		blocks = append(blocks, block)
+	})
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no free /%d in %s", ones, s.GetCidr())
+	}
+
+	x := randUint128(src, last)
+	for _, block := range blocks {
+		count := subnetsLast(block.NetOnes, ones)
+		if x.Cmp(count) <= 0 {
+			offset := x.Lsh(uint(s.totalNumberOfBits() - ones))
+			return newSubnetFromInt(block.NetInt.Add(offset), ones, s.isIPv6), nil
+		}
+		x = x.Sub(count).Sub64(1)
+	}
+
+	return nil, fmt.Errorf("no free /%d in %s", ones, s.GetCidr())
+}
@@ -0,0 +1,139 @@
+package ipcalc
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestRandomIP(t *testing.T) {
+	src := rand.NewSource(1)
+
+	// 8 addresses drawn 8000 times, each should come up about 1000 times.
+	counts := map[string]int{}
+	r := testRange("10.0.0.250", "10.0.1.1")
+	for i := 0; i < 8000; i++ {
+		ip, err := r.RandomIP(src, SampleOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.Contains(ip) {
+			t.Fatalf("got %s, want an address of %s", ip, r)
+		}
+		counts[ip.String()]++
+	}
+	if len(counts) != 8 {
+		t.Errorf("got %d different addresses, want 8", len(counts))
+	}
+	for ip, n := range counts {
+		if n < 850 || n > 1150 {
+			t.Errorf("%s: got %d draws, want about 1000", ip, n)
+		}
+	}
+
+	for _, cidr := range []string{"192.0.2.0/30", "2001:db8::/126"} {
+		s := NewSubnet(cidr)
+		seen := map[string]bool{}
+		for i := 0; i < 200; i++ {
+			ip, _ := s.RandomIP(src, SampleOptions{HostsOnly: true})
+			seen[ip.String()] = true
+		}
+		if seen[s.GetNetworkStr()] || seen["192.0.2.3"] || len(seen) < 2 {
+			t.Errorf("%s: got %v, want only host addresses", cidr, seen)
+		}
+	}
+
+	full := testRange("::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")
+	high := 0
+	for i := 0; i < 100; i++ {
+		ip, err := full.RandomIP(src, SampleOptions{Exclude: ClassMulticast})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip[0] == 0xff {
+			t.Fatalf("got multicast %s, want it excluded", ip)
+		}
+		if ip[0] >= 0x80 {
+			high++
+		}
+	}
+	if high < 30 || high > 70 {
+		t.Errorf("got %d of 100 addresses in the upper half, want about 50", high)
+	}
+
+	if _, err := NewSubnet("192.0.2.0/24").RandomIP(src, SampleOptions{Exclude: ClassDocumentation}); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+}
+
+func TestIPSetRandomIP(t *testing.T) {
+	src := rand.NewSource(2)
+	set := NewIPSet("test", "hash:net", false)
+	for _, cidr := range []string{"10.0.0.0/30", "10.0.0.0/31", "192.0.2.8/29", "198.51.100.1/32"} {
+		set.Add(NewSubnet(cidr))
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 13000; i++ {
+		ip, err := set.RandomIP(src, SampleOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !set.Contains(ip) {
+			t.Fatalf("got %s, want an address of the set", ip)
+		}
+		counts[ip.String()]++
+	}
+	// 4 + 8 + 1 addresses, the nested /31 does not count twice.
+	if len(counts) != 13 || counts["10.0.0.0"] < 850 || counts["10.0.0.0"] > 1150 || counts["198.51.100.1"] < 850 || counts["198.51.100.1"] > 1150 {
+		t.Errorf("got counts %v, want 13 addresses about 1000 times each", counts)
+	}
+
+	if ip, err := set.RandomIP(src, SampleOptions{HostsOnly: true}); err != nil || ip.Equal(net.ParseIP("10.0.0.0")) {
+		t.Errorf("got %s and error %v, want a host address", ip, err)
+	}
+
+	if _, err := NewIPSet("empty", "hash:net", true).RandomIP(src, SampleOptions{}); err == nil {
+		t.Errorf("empty set: got nil error, wanted failure")
+	}
+}
+
+func TestRandomSubnet(t *testing.T) {
+	src := rand.NewSource(3)
+	pool := NewSubnet("10.20.0.0/16")
+	for _, cidr := range []string{"10.20.0.0/17", "10.20.128.0/18", "10.20.192.0/24"} {
+		pool.Insert(NewSubnet(cidr))
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 6300; i++ {
+		s, err := pool.RandomSubnet(src, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.NetOnes != 24 || !pool.Covers(s) {
+			t.Fatalf("got %s, want a /24 of the pool", s.GetCidr())
+		}
+		for _, n := range pool.Covering(s) {
+			if n != pool {
+				t.Fatalf("got %s overlapping %s, want a free subnet", s.GetCidr(), n.GetCidr())
+			}
+		}
+		counts[s.GetCidr()]++
+	}
+	// 63 free /24s.
+	if len(counts) != 63 {
+		t.Errorf("got %d different subnets, want 63", len(counts))
+	}
+
+	if _, err := pool.RandomSubnet(src, 17); err == nil {
+		t.Errorf("/17: got nil error, wanted failure")
+	}
+	if _, err := pool.RandomSubnet(src, 15); err == nil {
+		t.Errorf("/15: got nil error, wanted failure")
+	}
+
+	if s, err := NewSubnet("::/0").RandomSubnet(src, 128); err != nil || s.NetOnes != 128 {
+		t.Errorf("got %v and error %v, want a /128", s, err)
+	}
+}
@@ -0,0 +1,112 @@
+package ipcalc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+func (s *Subnet) checkSLAACPrefix() error {
+	if !s.isIPv6 || s.NetOnes != 64 {
+		return fmt.Errorf("slaac prefix has to be an ipv6 /64")
+	}
+
+	return nil
+}
+
+// EUI64Address returns the SLAAC address of mac in the /64 prefix s, using the
+// modified EUI-64 interface identifier (RFC 4291 appendix A). mac can be a
+// 48 or a 64 bit hardware address.
+func (s *Subnet) EUI64Address(mac net.HardwareAddr) (net.IP, error) {
+	if err := s.checkSLAACPrefix(); err != nil {
+		return nil, err
+	}
+
+	res := s.GetNetwork()
+	switch len(mac) {
+	case 6:
+		copy(res[8:11], mac[0:3])
+		res[11] = 0xff
+		res[12] = 0xfe
+		copy(res[13:16], mac[3:6])
+	case 8:
+		copy(res[8:16], mac)
+	default:
+		return nil, fmt.Errorf("invalid hardware address length %d", len(mac))
+	}
+	res[8] ^= 0x02
+
+	return res, nil
+}
+
+// MACFromEUI64 returns the 48 bit hardware address of a modified EUI-64
+// interface identifier.
+func MACFromEUI64(ip net.IP) (net.HardwareAddr, error) {
+	ip, err := toIPv6(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip[11] != 0xff || ip[12] != 0xfe {
+		return nil, fmt.Errorf("not an eui-64 based address")
+	}
+
+	return net.HardwareAddr{ip[8] ^ 0x02, ip[9], ip[10], ip[13], ip[14], ip[15]}, nil
+}
+
+// isReservedIID reports the interface identifiers of the IANA reserved IPv6
+// interface identifier registry (RFC 5453).
+func isReservedIID(iid uint64) bool {
+	switch {
+	case iid == 0:
+		// Subnet-Router Anycast
+		return true
+	case iid>>24 == 0x02005efffe:
+		// Reserved IPv6 Interface Identifiers corresponding to the IANA
+		// Ethernet Block
+		return true
+	case iid >= 0xfdffffffffffff80 && iid <= 0xfdffffffffffffff:
+		// Reserved Subnet Anycast Addresses
+		return true
+	}
+
+	return false
+}
+
+// StablePrivacyAddress returns the RFC 7217 stable, semantically opaque
+// address of an interface in the /64 prefix s. The pseudorandom function is
+// HMAC-SHA256 keyed with secret, over the prefix, the interface name, the
+// network id and the DAD counter. Reserved interface identifiers are skipped
+// by increasing the DAD counter, like after a duplicate address detection
+// failure.
+func (s *Subnet) StablePrivacyAddress(netIface string, networkID []byte, dadCounter uint8, secret []byte) (net.IP, error) {
+	if err := s.checkSLAACPrefix(); err != nil {
+		return nil, err
+	}
+
+	if len(secret) < 16 {
+		return nil, fmt.Errorf("secret key has to be at least 128 bits long")
+	}
+
+	res := s.GetNetwork()
+	for {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(res[:8])
+		mac.Write([]byte(netIface))
+		mac.Write(networkID)
+		mac.Write([]byte{dadCounter})
+		iid := binary.BigEndian.Uint64(mac.Sum(nil))
+
+		if !isReservedIID(iid) {
+			binary.BigEndian.PutUint64(res[8:], iid)
+			return res, nil
+		}
+
+		if dadCounter == 255 {
+			return nil, fmt.Errorf("could not generate a non reserved interface identifier")
+		}
+		dadCounter++
+	}
+}
@@ -0,0 +1,114 @@
+package ipcalc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestEUI64Address(t *testing.T) {
+	var tests = []struct {
+		prefix, mac, want string
+	}{
+		{"2001:db8::/64", "00:1b:63:84:45:e6", "2001:db8::21b:63ff:fe84:45e6"},
+		{"fe80::/64", "02:00:00:00:00:01", "fe80::ff:fe00:1"},
+		{"2001:db8:1:2::/64", "00:00:5e:10:00:00:00:01", "2001:db8:1:2:200:5e10::1"},
+		{"2001:db8::/48", "00:1b:63:84:45:e6", ""},
+		{"10.0.0.0/8", "00:1b:63:84:45:e6", ""},
+	}
+
+	for _, tt := range tests {
+		mac, _ := net.ParseMAC(tt.mac)
+		got, err := NewSubnet(tt.prefix).EUI64Address(mac)
+		if err != nil {
+			if tt.want != "" {
+				t.Errorf("%s %s: %v", tt.prefix, tt.mac, err)
+			}
+			continue
+		}
+
+		if !got.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("%s %s: got %s, want %s", tt.prefix, tt.mac, got, tt.want)
+		}
+
+		if len(mac) != 6 {
+			continue
+		}
+
+		back, err := MACFromEUI64(got)
+		if err != nil || back.String() != mac.String() {
+			t.Errorf("%s: got mac %s %v, want %s", got, back, err, mac)
+		}
+	}
+
+	if _, err := MACFromEUI64(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("extracting a mac from a non eui-64 address should fail")
+	}
+}
+
+func TestStablePrivacyAddress(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	prefix := NewSubnet("2001:db8:1:2::/64")
+
+	a, err := prefix.StablePrivacyAddress("eth0", nil, 0, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !prefix.Covers(newHostSubnet(a)) {
+		t.Errorf("%s is not in %s", a, prefix.GetCidr())
+	}
+
+	again, _ := prefix.StablePrivacyAddress("eth0", nil, 0, secret)
+	if !a.Equal(again) {
+		t.Errorf("address is not stable: %s != %s", a, again)
+	}
+
+	others := []net.IP{}
+	other, _ := NewSubnet("2001:db8:1:3::/64").StablePrivacyAddress("eth0", nil, 0, secret)
+	others = append(others, other)
+	other, _ = prefix.StablePrivacyAddress("eth1", nil, 0, secret)
+	others = append(others, other)
+	other, _ = prefix.StablePrivacyAddress("eth0", []byte("ssid"), 0, secret)
+	others = append(others, other)
+	other, _ = prefix.StablePrivacyAddress("eth0", nil, 1, secret)
+	others = append(others, other)
+	other, _ = prefix.StablePrivacyAddress("eth0", nil, 0, []byte("fedcba9876543210fedcba9876543210"))
+	others = append(others, other)
+
+	for _, other := range others {
+		if other == nil || other[8:].Equal(a[8:]) {
+			t.Errorf("got same interface identifier %s for different inputs", other)
+		}
+	}
+
+	if _, err := prefix.StablePrivacyAddress("eth0", nil, 0, []byte("short")); err == nil {
+		t.Errorf("a short secret should fail")
+	}
+
+	if _, err := NewSubnet("2001:db8::/56").StablePrivacyAddress("eth0", nil, 0, secret); err == nil {
+		t.Errorf("a non /64 prefix should fail")
+	}
+}
+
+func TestIsReservedIID(t *testing.T) {
+	var tests = []struct {
+		iid  uint64
+		want bool
+	}{
+		{0, true},
+		{1, false},
+		{0x02005efffe000000, true},
+		{0x02005efffeffffff, true},
+		{0x02005effff000000, false},
+		{0xfdffffffffffff7f, false},
+		{0xfdffffffffffff80, true},
+		{0xfdffffffffffffff, true},
+		{0xfe00000000000000, false},
+	}
+
+	for _, tt := range tests {
+		if got := isReservedIID(tt.iid); got != tt.want {
+			t.Errorf("%x: got %t, want %t", tt.iid, got, tt.want)
+		}
+	}
+}
@@ -33,6 +33,9 @@ func NewSubnet(cidr string) *Subnet {
 
 	ipIntBase, _ := ipToInt(net.IP)
 	ones, bits := net.Mask.Size()
+	if bits == 128 {
+		ipIntBase = ipToInt128(net.IP)
+	}
 	subnet := &Subnet{
 		isIPv6:   bits == 128,
 		NetInt:   ipIntBase,
@@ -44,6 +47,29 @@ func NewSubnet(cidr string) *Subnet {
 	return subnet
 }
 
+func newSubnetFromInt(netInt uint128.Uint128, ones uint8, isIPv6 bool) *Subnet {
+	subnet := &Subnet{
+		isIPv6:   isIPv6,
+		NetOnes:  ones,
+		children: make([]*Subnet, 2),
+	}
+	subnet.MaskInt = subnet.calcMaskInt()
+	subnet.NetInt = netInt.And(subnet.MaskInt)
+
+	return subnet
+}
+
+// newHostSubnet returns the /32 or /128 subnet of ip. IPv4-mapped addresses
+// become IPv4 hosts, like in net.IP.To4.
+func newHostSubnet(ip net.IP) *Subnet {
+	if ip == nil {
+		return nil
+	}
+
+	ipInt, bits := ipToInt(ip)
+	return newSubnetFromInt(ipInt, uint8(bits), bits == 128)
+}
+
 func (s *Subnet) CloneBase() *Subnet {
 	subnet := &Subnet{
 		isIPv6:   s.isIPv6,
@@ -102,7 +128,7 @@ func (s *Subnet) Lookup(f *Subnet) (*Subnet, error) {
 		bitVal := f.bitValue(uint8(bitPos))
 
 		child = child.children[bitVal]
-		if child.Contains(f) && !child.isDummy {
+		if child.Covers(f) && !child.isDummy {
 			best = child
 		}
 	}
@@ -110,6 +136,45 @@ func (s *Subnet) Lookup(f *Subnet) (*Subnet, error) {
 	return best, nil
 }
 
+// Covering returns every node covering f, from the least to the most
+// specific one.
+func (s *Subnet) Covering(f *Subnet) []*Subnet {
+	res := []*Subnet{}
+	for child := s; child != nil && child.Covers(f); {
+		if !child.isDummy {
+			res = append(res, child)
+		}
+
+		if child.NetOnes == f.NetOnes {
+			break
+		}
+		child = child.children[f.bitValue(uint8(child.targetBitPosition()))]
+	}
+
+	return res
+}
+
+// firstCovered returns the first node covered by f in address order, or nil.
+func (s *Subnet) firstCovered(f *Subnet) *Subnet {
+	for node := s; node != nil; {
+		if f.Covers(node) {
+			var res *Subnet
+			node.Walk(func(c *Subnet) bool {
+				res = c
+				return false
+			})
+			return res
+		}
+
+		if !node.Covers(f) {
+			return nil
+		}
+		node = node.children[f.bitValue(node.targetBitPosition())]
+	}
+
+	return nil
+}
+
 func (s *Subnet) Insert(newChild *Subnet) (bool, error) {
 	// fmt.Printf("Inserting %s into %s\n", newChild, s)
 	// fmt.Println("----------------------------------------------------------")
@@ -124,6 +189,7 @@ func (s *Subnet) Insert(newChild *Subnet) (bool, error) {
 	if newChild.NetOnes == s.NetOnes {
 		if s.isDummy {
 			s.isDummy = false
+			s.Meta = newChild.Meta
 			return true, nil
 		}
 		return false, fmt.Errorf("already there")
@@ -147,20 +213,29 @@ func (s *Subnet) Insert(newChild *Subnet) (bool, error) {
 		return true, nil
 	}
 
-	commonOnes := existingChild.CommonOnes(newChild, false)
+	commonOnes := existingChild.CommonOnes(newChild, true)
 	// fmt.Printf(" existingChild and newChild has %d common ones\n", commonOnes)
 
 	//divergingBitPos := commonOnes //- 1
 	// fmt.Printf(" divergingBitPos=%d existingChild.targetBitPosition()=%d\n", divergingBitPos, existingChild.targetBitPosition())
 
+	if existingChild.NetOnes > commonOnes && newChild.NetOnes == commonOnes {
+		// newChild contains existingChild, so it takes its place.
+		s.children[bitVal] = newChild
+		newChild.parent = s
+		newChild.children[existingChild.bitValue(newChild.targetBitPosition())] = existingChild
+		existingChild.parent = newChild
+		return true, nil
+	}
+
 	if existingChild.NetOnes > commonOnes {
 		/*var asd uint8 = 32
 		if newChild.isIPv6 {
 			asd = 128
 		}*/
-		dummySubnet := newChild.CloneWithOnes(existingChild.CommonOnes(newChild, true))
+		dummySubnet := newChild.CloneWithOnes(commonOnes)
 		dummySubnet.isDummy = true
-		fmt.Printf(" insert dummySubnet=%s\n", dummySubnet)
+		// fmt.Printf(" insert dummySubnet=%s\n", dummySubnet)
 
 		// Place dummySubnet
 		s.children[bitVal] = dummySubnet
@@ -184,6 +259,27 @@ func (s *Subnet) Insert(newChild *Subnet) (bool, error) {
 	return existingChild.Insert(newChild)
 }
 
+// Walk calls fn for every non-dummy node of the tree in address order,
+// parents before their children. It stops and returns false as soon as fn
+// returns false.
+func (s *Subnet) Walk(fn func(*Subnet) bool) bool {
+	if s == nil {
+		return true
+	}
+
+	if !s.isDummy && !fn(s) {
+		return false
+	}
+
+	for _, child := range s.children {
+		if !child.Walk(fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *Subnet) Intersect(s2 *Subnet) bool {
 	if s == nil {
 		return false
@@ -209,6 +305,11 @@ func (s *Subnet) Contains(s2 *Subnet) bool {
 	return s.NetInt.And(s.MaskInt).Cmp(s2.NetInt.And(s.MaskInt)) == 0
 }
 
+// Covers is like Contains, but s2 also has to fit entirely into s.
+func (s *Subnet) Covers(s2 *Subnet) bool {
+	return s.Contains(s2) && s.isIPv6 == s2.isIPv6 && s.NetOnes <= s2.NetOnes
+}
+
 func (s *Subnet) GetNetwork() net.IP {
 	if s.isIPv6 {
 		return intToIPv6(s.NetInt)
@@ -218,7 +319,7 @@ func (s *Subnet) GetNetwork() net.IP {
 }
 
 func (s *Subnet) GetNetworkStr() string {
-	return s.GetNetwork().String()
+	return ipString(s.GetNetwork(), s.isIPv6)
 }
 
 //
@@ -246,7 +347,7 @@ func (s *Subnet) CommonOnes(s2 *Subnet, checkOnes bool) uint8 {
 }
 
 func (s *Subnet) GetCidr() string {
-	return fmt.Sprintf("%s/%d", s.GetNetwork(), s.NetOnes)
+	return fmt.Sprintf("%s/%d", s.GetNetworkStr(), s.NetOnes)
 }
 
 func (s *Subnet) DebugString() string {
@@ -261,6 +362,12 @@ func (s *Subnet) totalNumberOfBits() uint8 {
 	return 32
 }
 
+// lastInt returns the last address of s.
+func (s *Subnet) lastInt() uint128.Uint128 {
+	bits := int(s.totalNumberOfBits())
+	return s.NetInt.Or(s.MaskInt.Xor(maskToInt(bits, bits)))
+}
+
 func (s *Subnet) calcMaskInt() uint128.Uint128 {
 	return maskToInt(int(s.NetOnes), int(s.totalNumberOfBits()))
 }
@@ -331,6 +438,10 @@ func (s *Subnet) IsIPv6() bool {
 	return s.isIPv6
 }
 
+func (s *Subnet) IsDummy() bool {
+	return s.isDummy
+}
+
 func (s *Subnet) GetVersion() int8 {
 	if s.isIPv6 {
 		return 6
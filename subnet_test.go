@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -278,3 +279,119 @@ func BenchmarkGoNativeContains(b *testing.B) {
 		net1.Contains(net2.IP)
 	}
 }
+
+func TestInsertSupernetAfterSubnet(t *testing.T) {
+	root := NewSubnet("10.0.0.0/8")
+	for _, cidr := range []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.0.0/24", "10.0.0.0/16"} {
+		s := NewSubnet(cidr)
+		s.Meta = cidr
+		if _, err := root.Insert(s); err != nil {
+			t.Errorf("insert %s: %v", cidr, err)
+		}
+	}
+
+	for _, cidr := range []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.0.0/24", "10.0.0.0/16"} {
+		found, err := root.Find(NewSubnet(cidr))
+		if err != nil {
+			t.Errorf("find %s: %v", cidr, err)
+			continue
+		}
+		if found.Meta != cidr {
+			t.Errorf("find %s: got meta %q", cidr, found.Meta)
+		}
+	}
+
+	best, _ := root.Lookup(NewSubnet("10.0.0.200/32"))
+	if best.GetCidr() != "10.0.0.128/25" {
+		t.Errorf("got %s, want 10.0.0.128/25", best.GetCidr())
+	}
+}
+
+func TestNewSubnetIPv4Mapped(t *testing.T) {
+	s := NewSubnet("::ffff:10.0.0.0/104")
+	if !s.IsIPv6() {
+		t.Fatalf("got ipv4 subnet, want ipv6")
+	}
+
+	if s.GetCidr() != "::ffff:10.0.0.0/104" {
+		t.Errorf("got %s, want ::ffff:10.0.0.0/104", s.GetCidr())
+	}
+
+	if !NewSubnet("::ffff:0:0/96").Contains(s) {
+		t.Errorf("::ffff:0:0/96 should contain %s", s.GetCidr())
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	root := NewSubnet("10.0.0.0/8")
+	for _, cidr := range []string{"10.2.0.0/16", "10.1.2.0/24", "10.1.0.0/16", "10.1.1.0/24"} {
+		root.Insert(NewSubnet(cidr))
+	}
+
+	got := []string{}
+	root.Walk(func(s *Subnet) bool {
+		got = append(got, s.GetCidr())
+		return true
+	})
+
+	want := "10.0.0.0/8 10.1.0.0/16 10.1.1.0/24 10.1.2.0/24 10.2.0.0/16"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestLookupLargerThanChildren(t *testing.T) {
+	root := NewSubnet("0.0.0.0/0")
+	root.Insert(NewSubnet("10.0.0.0/8"))
+	root.Insert(NewSubnet("10.0.0.0/24"))
+
+	var tests = []struct {
+		cidr, want string
+	}{
+		{"10.0.0.0/7", "0.0.0.0/0"},
+		{"10.0.0.0/16", "10.0.0.0/8"},
+		{"10.0.0.0/25", "10.0.0.0/24"},
+	}
+
+	for _, tt := range tests {
+		got, err := root.Lookup(NewSubnet(tt.cidr))
+		if err != nil {
+			t.Errorf("lookup %s: %v", tt.cidr, err)
+			continue
+		}
+		if got.GetCidr() != tt.want {
+			t.Errorf("lookup %s: got %s, want %s", tt.cidr, got.GetCidr(), tt.want)
+		}
+	}
+}
+
+func TestCovering(t *testing.T) {
+	root := NewSubnet("0.0.0.0/0")
+	root.isDummy = true
+	for _, cidr := range []string{"10.0.0.0/8", "10.0.0.0/24", "10.0.0.0/16", "10.0.1.0/24", "10.0.0.128/25"} {
+		if _, err := root.Insert(NewSubnet(cidr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		cidr, want string
+	}{
+		{"10.0.0.0/7", ""},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"10.0.0.0/25", "10.0.0.0/8 10.0.0.0/16 10.0.0.0/24"},
+		{"10.0.0.200/32", "10.0.0.0/8 10.0.0.0/16 10.0.0.0/24 10.0.0.128/25"},
+		{"10.0.1.0/23", "10.0.0.0/8 10.0.0.0/16"},
+		{"11.0.0.1/32", ""},
+	}
+
+	for _, tt := range tests {
+		got := []string{}
+		for _, s := range root.Covering(NewSubnet(tt.cidr)) {
+			got = append(got, s.GetCidr())
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("covering %s: got %v, want %s", tt.cidr, got, tt.want)
+		}
+	}
+}
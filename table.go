@@ -0,0 +1,284 @@
+package ipcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+)
+
+var ipv4MappedPrefix = NewSubnet("::ffff:0:0/96")
+
+// Table holds IPv4 and IPv6 prefixes together, each family in its own tree.
+type Table struct {
+	// MapIPv4 stores IPv4-mapped IPv6 prefixes (::ffff:0:0/96) in the IPv4
+	// tree, so they are aliases of the matching IPv4 entries.
+	MapIPv4 bool
+
+	ipv4 *Subnet
+	ipv6 *Subnet
+}
+
+type tableEntry struct {
+	Cidr string `json:"cidr"`
+	Meta string `json:"meta,omitempty"`
+}
+
+func NewTable() *Table {
+	t := &Table{}
+	t.reset()
+	return t
+}
+
+func (t *Table) reset() {
+	t.ipv4 = NewSubnet("0.0.0.0/0")
+	t.ipv4.isDummy = true
+	t.ipv6 = NewSubnet("::/0")
+	t.ipv6.isDummy = true
+}
+
+// route returns the tree responsible for s and s itself, converted to IPv4
+// when it is an alias of an IPv4 prefix.
+func (t *Table) route(s *Subnet) (*Subnet, *Subnet) {
+	if !s.isIPv6 {
+		return t.ipv4, s
+	}
+
+	if t.MapIPv4 {
+		if mapped, err := s.FromIPv4Mapped(); err == nil {
+			mapped.Meta = s.Meta
+			return t.ipv4, mapped
+		}
+	}
+
+	return t.ipv6, s
+}
+
+func (t *Table) Insert(s *Subnet) (bool, error) {
+	if s == nil {
+		return false, fmt.Errorf("invalid subnet")
+	}
+
+	root, s := t.route(s)
+	return root.Insert(s)
+}
+
+func (t *Table) InsertCidr(cidr, meta string) (bool, error) {
+	s := NewSubnet(cidr)
+	if s == nil {
+		return false, fmt.Errorf("could not parse cidr %q", cidr)
+	}
+	s.Meta = meta
+
+	return t.Insert(s)
+}
+
+// insertOrFind returns the node of s in the table, inserting a copy of s
+// when it is not there yet.
+func (t *Table) insertOrFind(s *Subnet) (*Subnet, error) {
+	if node, err := t.Find(s); err == nil {
+		return node, nil
+	}
+
+	if _, err := t.Insert(s.CloneBase()); err != nil {
+		return nil, err
+	}
+
+	return t.Find(s)
+}
+
+func (t *Table) Find(s *Subnet) (*Subnet, error) {
+	if s == nil {
+		return nil, fmt.Errorf("invalid subnet")
+	}
+
+	root, s := t.route(s)
+	return root.Find(s)
+}
+
+func (t *Table) Lookup(s *Subnet) (*Subnet, error) {
+	if s == nil {
+		return nil, fmt.Errorf("invalid subnet")
+	}
+
+	root, s := t.route(s)
+	best, err := root.Lookup(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if best.isDummy {
+		return nil, fmt.Errorf("not found")
+	}
+
+	return best, nil
+}
+
+// Covering returns every prefix covering s, from the least to the most
+// specific one.
+func (t *Table) Covering(s *Subnet) []*Subnet {
+	if s == nil {
+		return nil
+	}
+
+	root, s := t.route(s)
+	return root.Covering(s)
+}
+
+// FreeBlocks returns the free blocks of s like Subnet.FreeBlocks, s does not
+// have to be in the table.
+func (t *Table) FreeBlocks(s *Subnet, maxOnes uint8) []*Subnet {
+	if s == nil {
+		return nil
+	}
+
+	root, s := t.route(s)
+	return root.subtreeOf(s).FreeBlocks(maxOnes)
+}
+
+func (t *Table) LookupIP(ip net.IP) (*Subnet, error) {
+	return t.Lookup(newHostSubnet(ip))
+}
+
+// Walk calls fn for every prefix, IPv4 ones first. It stops and returns false
+// as soon as fn returns false.
+func (t *Table) Walk(fn func(*Subnet) bool) bool {
+	return t.ipv4.Walk(fn) && t.ipv6.Walk(fn)
+}
+
+func (t *Table) LenIPv4() int {
+	return countNodes(t.ipv4)
+}
+
+func (t *Table) LenIPv6() int {
+	return countNodes(t.ipv6)
+}
+
+func (t *Table) Len() int {
+	return t.LenIPv4() + t.LenIPv6()
+}
+
+func countNodes(s *Subnet) int {
+	n := 0
+	s.Walk(func(*Subnet) bool {
+		n++
+		return true
+	})
+
+	return n
+}
+
+// lessSubnet orders IPv4 before IPv6, then by address and parents before
+// their children.
+func lessSubnet(a, b *Subnet) bool {
+	if a.isIPv6 != b.isIPv6 {
+		return !a.isIPv6
+	}
+
+	if c := a.NetInt.Cmp(b.NetInt); c != 0 {
+		return c < 0
+	}
+
+	return a.NetOnes < b.NetOnes
+}
+
+// BuildTable builds a table bottom-up, which is much faster than inserting
+// the subnets one by one. The subnets become the nodes of the table, they
+// are sorted in place and must not contain duplicates.
+func BuildTable(subnets []*Subnet) (*Table, error) {
+	less := func(i, j int) bool {
+		return lessSubnet(subnets[i], subnets[j])
+	}
+	if !sort.SliceIsSorted(subnets, less) {
+		sort.SliceStable(subnets, less)
+	}
+
+	t := NewTable()
+	split := sort.Search(len(subnets), func(i int) bool {
+		return subnets[i].isIPv6
+	})
+
+	if err := buildSorted(t.ipv4, subnets[:split]); err != nil {
+		return nil, err
+	}
+	if err := buildSorted(t.ipv6, subnets[split:]); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// buildSorted adds sorted subnets to an empty tree. Subnets are always added
+// to the rightmost path of the tree, which is kept on a stack.
+func buildSorted(root *Subnet, subnets []*Subnet) error {
+	stack := []*Subnet{root}
+	for i, s := range subnets {
+		if i > 0 && s.SameSubnet(subnets[i-1]) {
+			return fmt.Errorf("duplicate subnet %s", s.GetCidr())
+		}
+
+		if len(s.children) == 2 {
+			s.children[0], s.children[1] = nil, nil
+		} else {
+			s.children = make([]*Subnet, 2)
+		}
+		if s.NetOnes == root.NetOnes {
+			root.isDummy = false
+			root.Meta = s.Meta
+			continue
+		}
+
+		for !stack[len(stack)-1].Covers(s) {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+
+		// The last child of parent is the previous subnet or one of its
+		// parents, which does not cover s, so they need a common parent.
+		bitVal := s.bitValue(parent.targetBitPosition())
+		if existing := parent.children[bitVal]; existing != nil {
+			dummy := s.CloneWithOnes(existing.CommonOnes(s, true))
+			dummy.isDummy = true
+			parent.children[bitVal] = dummy
+			dummy.parent = parent
+			dummy.children[existing.bitValue(dummy.targetBitPosition())] = existing
+			existing.parent = dummy
+
+			stack = append(stack, dummy)
+			parent = dummy
+			bitVal = s.bitValue(parent.targetBitPosition())
+		}
+
+		parent.children[bitVal] = s
+		s.parent = parent
+		stack = append(stack, s)
+	}
+
+	return nil
+}
+
+func (t *Table) MarshalJSON() ([]byte, error) {
+	entries := []tableEntry{}
+	t.Walk(func(s *Subnet) bool {
+		entries = append(entries, tableEntry{Cidr: s.GetCidr(), Meta: s.Meta})
+		return true
+	})
+
+	return json.Marshal(entries)
+}
+
+func (t *Table) UnmarshalJSON(data []byte) error {
+	var entries []tableEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	t.reset()
+	for _, entry := range entries {
+		if _, err := t.InsertCidr(entry.Cidr, entry.Meta); err != nil {
+			return fmt.Errorf("%s: %v", entry.Cidr, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package ipcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"testing"
+)
+
+func TestTableLookup(t *testing.T) {
+	table := NewTable()
+	for _, cidr := range []string{
+		"10.0.0.0/8",
+		"10.1.0.0/16",
+		"2001:db8::/32",
+		"2001:db8:1::/48",
+		"::ffff:192.168.0.0/112",
+	} {
+		if _, err := table.InsertCidr(cidr, cidr); err != nil {
+			t.Fatalf("insert %s: %v", cidr, err)
+		}
+	}
+
+	var tests = []struct {
+		ip, want string
+	}{
+		{"10.2.3.4", "10.0.0.0/8"},
+		{"10.1.3.4", "10.1.0.0/16"},
+		{"2001:db8::1", "2001:db8::/32"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db9::1", ""},
+		{"11.0.0.1", ""},
+		// net.IP does not keep the difference between the two forms.
+		{"::ffff:10.1.0.1", "10.1.0.0/16"},
+		{"192.168.1.1", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := table.LookupIP(net.ParseIP(tt.ip))
+		if err != nil {
+			if tt.want != "" {
+				t.Errorf("lookup %s: %v, want %s", tt.ip, err, tt.want)
+			}
+			continue
+		}
+
+		if got.Meta != tt.want {
+			t.Errorf("lookup %s: got %s, want %s", tt.ip, got.Meta, tt.want)
+		}
+	}
+
+	mapped, err := table.Find(NewSubnet("::ffff:192.168.0.0/112"))
+	if err != nil || mapped.GetCidr() != "::ffff:192.168.0.0/112" {
+		t.Errorf("got %v %v, want ::ffff:192.168.0.0/112", mapped, err)
+	}
+
+	if table.LenIPv4() != 2 || table.LenIPv6() != 3 || table.Len() != 5 {
+		t.Errorf("got lengths %d/%d/%d, want 2/3/5", table.LenIPv4(), table.LenIPv6(), table.Len())
+	}
+}
+
+func TestTableMapIPv4(t *testing.T) {
+	table := NewTable()
+	table.MapIPv4 = true
+
+	table.InsertCidr("::ffff:192.168.0.0/112", "mapped")
+	if table.LenIPv4() != 1 || table.LenIPv6() != 0 {
+		t.Fatalf("got lengths %d/%d, want 1/0", table.LenIPv4(), table.LenIPv6())
+	}
+
+	got, err := table.Lookup(NewSubnet("192.168.1.0/24"))
+	if err != nil || got.Meta != "mapped" {
+		t.Errorf("got %v %v, want mapped", got, err)
+	}
+
+	got, err = table.Find(NewSubnet("192.168.0.0/16"))
+	if err != nil || got.Meta != "mapped" {
+		t.Errorf("got %v %v, want mapped", got, err)
+	}
+
+	if _, err := table.InsertCidr("192.168.0.0/16", "plain"); err == nil {
+		t.Errorf("inserting the alias of an existing prefix should fail")
+	}
+}
+
+func TestTableWalkAndJSON(t *testing.T) {
+	table := NewTable()
+	cidrs := []string{"0.0.0.0/0", "10.0.0.0/24", "10.0.0.0/8", "2001:db8::/32", "fe80::/10"}
+	for _, cidr := range cidrs {
+		table.InsertCidr(cidr, "meta "+cidr)
+	}
+
+	data, err := json.Marshal(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"cidr":"0.0.0.0/0","meta":"meta 0.0.0.0/0"},` +
+		`{"cidr":"10.0.0.0/8","meta":"meta 10.0.0.0/8"},` +
+		`{"cidr":"10.0.0.0/24","meta":"meta 10.0.0.0/24"},` +
+		`{"cidr":"2001:db8::/32","meta":"meta 2001:db8::/32"},` +
+		`{"cidr":"fe80::/10","meta":"meta fe80::/10"}]`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	table2 := NewTable()
+	if err := json.Unmarshal(data, table2); err != nil {
+		t.Fatal(err)
+	}
+
+	data2, _ := json.Marshal(table2)
+	if string(data2) != want {
+		t.Errorf("round trip got %s, want %s", data2, want)
+	}
+
+	if err := json.Unmarshal([]byte(`[{"cidr":"bogus"}]`), table2); err == nil {
+		t.Errorf("got nil error, wanted failure")
+	}
+
+	n := 0
+	table.Walk(func(s *Subnet) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("walk did not stop, visited %d", n)
+	}
+}
+
+func randSubnets(n int) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for len(res) < n {
+		var cidr string
+		if rand.Intn(4) == 0 {
+			cidr = fmt.Sprintf("2001:db8:%x::/%d", rand.Intn(0x10000), 32+rand.Intn(33))
+		} else {
+			cidr = fmt.Sprintf("%s/%d", randIPv4Addr(), 1+rand.Intn(32))
+		}
+		cidr = NewSubnet(cidr).GetCidr()
+		if !seen[cidr] {
+			seen[cidr] = true
+			res = append(res, cidr)
+		}
+	}
+
+	return res
+}
+
+func TestBuildTable(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		cidrs := randSubnets(300)
+		if round == 0 {
+			cidrs = append(cidrs, "0.0.0.0/0", "::/0")
+		}
+
+		inserted := NewTable()
+		subnets := []*Subnet{}
+		for _, cidr := range cidrs {
+			if _, err := inserted.InsertCidr(cidr, cidr); err != nil {
+				t.Fatal(err)
+			}
+			s := NewSubnet(cidr)
+			s.Meta = cidr
+			subnets = append(subnets, s)
+		}
+
+		built, err := BuildTable(subnets)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if built.ipv4.Print() != inserted.ipv4.Print() || built.ipv6.Print() != inserted.ipv6.Print() {
+			t.Fatalf("got\n%s\nwant\n%s", built.ipv4.Print()+built.ipv6.Print(), inserted.ipv4.Print()+inserted.ipv6.Print())
+		}
+
+		if _, err := built.InsertCidr("10.0.0.0/8", ""); err != nil && err.Error() != "already there" {
+			t.Errorf("got error %v, want nil or already there", err)
+		}
+	}
+
+	if _, err := BuildTable([]*Subnet{NewSubnet("10.0.0.0/8"), NewSubnet("10.0.0.0/8")}); err == nil {
+		t.Errorf("got nil error for duplicates, wanted failure")
+	}
+}
+
+func benchmarkSubnets(b *testing.B) []*Subnet {
+	res := []*Subnet{}
+	for _, cidr := range randSubnets(100000) {
+		res = append(res, NewSubnet(cidr))
+	}
+	sort.Slice(res, func(i, j int) bool { return lessSubnet(res[i], res[j]) })
+	b.ResetTimer()
+
+	return res
+}
+
+func cloneSubnets(b *testing.B, sorted []*Subnet) []*Subnet {
+	b.StopTimer()
+	defer b.StartTimer()
+
+	res := make([]*Subnet, 0, len(sorted))
+	for _, s := range sorted {
+		res = append(res, s.CloneBase())
+	}
+
+	return res
+}
+
+func BenchmarkBuildTable(b *testing.B) {
+	sorted := benchmarkSubnets(b)
+	for i := 0; i < b.N; i++ {
+		BuildTable(cloneSubnets(b, sorted))
+	}
+}
+
+func BenchmarkInsertSorted(b *testing.B) {
+	sorted := benchmarkSubnets(b)
+	for i := 0; i < b.N; i++ {
+		table := NewTable()
+		for _, s := range cloneSubnets(b, sorted) {
+			table.Insert(s)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package ipcalc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/vrgakos/uint128"
+)
+
+var (
+	ipv4CompatiblePrefix = NewSubnet("::/96")
+	sixToFourPrefix      = NewSubnet("2002::/16")
+	teredoPrefix         = NewSubnet("2001::/32")
+)
+
+func toIPv4(ip net.IP) (net.IP, error) {
+	ipv4 := ip.To4()
+	if ipv4 == nil {
+		return nil, fmt.Errorf("not an ipv4 address")
+	}
+
+	return ipv4, nil
+}
+
+func toIPv6(ip net.IP) (net.IP, error) {
+	if len(ip) != net.IPv6len {
+		return nil, fmt.Errorf("not an ipv6 address")
+	}
+
+	return ip, nil
+}
+
+// nat64Positions returns the bytes of an RFC 6052 address holding the IPv4
+// address. Bits 64 to 71 (the "u" octet) are always skipped.
+func nat64Positions(ones uint8) ([]int, error) {
+	switch ones {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return nil, fmt.Errorf("invalid nat64 prefix length /%d", ones)
+	}
+
+	positions := make([]int, 0, 4)
+	for i := int(ones / 8); len(positions) < 4; i++ {
+		if i == 8 {
+			continue
+		}
+		positions = append(positions, i)
+	}
+
+	return positions, nil
+}
+
+// NAT64Synthesize embeds ipv4 into the NAT64 prefix s as defined by RFC 6052.
+func (s *Subnet) NAT64Synthesize(ipv4 net.IP) (net.IP, error) {
+	if !s.isIPv6 {
+		return nil, fmt.Errorf("nat64 prefix has to be ipv6")
+	}
+
+	ipv4, err := toIPv4(ipv4)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := nat64Positions(s.NetOnes)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.GetNetwork()
+	for i, pos := range positions {
+		res[pos] = ipv4[i]
+	}
+
+	return res, nil
+}
+
+// NAT64Extract returns the IPv4 address embedded into ip by NAT64Synthesize.
+func (s *Subnet) NAT64Extract(ip net.IP) (net.IP, error) {
+	if !s.isIPv6 {
+		return nil, fmt.Errorf("nat64 prefix has to be ipv6")
+	}
+
+	ip, err := toIPv6(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := nat64Positions(s.NetOnes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.Covers(newSubnetFromInt(ipToInt128(ip), 128, true)) {
+		return nil, fmt.Errorf("ip address is not in the nat64 prefix")
+	}
+
+	if s.NetOnes < 96 && ip[8] != 0 {
+		return nil, fmt.Errorf("bits 64 to 71 of a nat64 address have to be zero")
+	}
+
+	res := make(net.IP, net.IPv4len)
+	for i, pos := range positions {
+		res[i] = ip[pos]
+	}
+
+	return res.To16(), nil
+}
+
+// Encode6to4 returns the 2002::/48 prefix of ipv4 (RFC 3056).
+func Encode6to4(ipv4 net.IP) (*Subnet, error) {
+	ipv4, err := toIPv4(ipv4)
+	if err != nil {
+		return nil, err
+	}
+
+	hi := uint64(0x2002)<<48 | uint64(binary.BigEndian.Uint32(ipv4))<<16
+	return newSubnetFromInt(uint128.New(0, hi), 48, true), nil
+}
+
+// Decode6to4 returns the IPv4 address embedded into a 6to4 address.
+func Decode6to4(ip net.IP) (net.IP, error) {
+	ip, err := toIPv6(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sixToFourPrefix.Covers(newSubnetFromInt(ipToInt128(ip), 128, true)) {
+		return nil, fmt.Errorf("not a 6to4 address")
+	}
+
+	return net.IPv4(ip[2], ip[3], ip[4], ip[5]), nil
+}
+
+// Teredo holds the fields of a Teredo address (RFC 4380). Port and Client
+// are stored without the obfuscation used in the address.
+type Teredo struct {
+	Server net.IP
+	Flags  uint16
+	Port   uint16
+	Client net.IP
+}
+
+func (t *Teredo) Cone() bool {
+	return t.Flags&0x8000 != 0
+}
+
+func DecodeTeredo(ip net.IP) (*Teredo, error) {
+	ip, err := toIPv6(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if !teredoPrefix.Covers(newSubnetFromInt(ipToInt128(ip), 128, true)) {
+		return nil, fmt.Errorf("not a teredo address")
+	}
+
+	return &Teredo{
+		Server: net.IPv4(ip[4], ip[5], ip[6], ip[7]),
+		Flags:  binary.BigEndian.Uint16(ip[8:10]),
+		Port:   binary.BigEndian.Uint16(ip[10:12]) ^ 0xffff,
+		Client: net.IPv4(ip[12]^0xff, ip[13]^0xff, ip[14]^0xff, ip[15]^0xff),
+	}, nil
+}
+
+func (t *Teredo) Encode() (net.IP, error) {
+	server, err := toIPv4(t.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := toIPv4(t.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint32(res[0:4], 0x20010000)
+	copy(res[4:8], server)
+	binary.BigEndian.PutUint16(res[8:10], t.Flags)
+	binary.BigEndian.PutUint16(res[10:12], t.Port^0xffff)
+	for i := range client {
+		res[12+i] = client[i] ^ 0xff
+	}
+
+	return res, nil
+}
+
+// ToIPv4Mapped returns the ::ffff:0:0/96 form of an IPv4 subnet.
+func (s *Subnet) ToIPv4Mapped() (*Subnet, error) {
+	if s.isIPv6 {
+		return nil, fmt.Errorf("subnet is already ipv6")
+	}
+
+	return newSubnetFromInt(ipv4MappedPrefix.NetInt.Or(s.NetInt), s.NetOnes+96, true), nil
+}
+
+// ToIPv4Compatible returns the deprecated ::/96 form of an IPv4 subnet.
+func (s *Subnet) ToIPv4Compatible() (*Subnet, error) {
+	if s.isIPv6 {
+		return nil, fmt.Errorf("subnet is already ipv6")
+	}
+
+	return newSubnetFromInt(s.NetInt, s.NetOnes+96, true), nil
+}
+
+func (s *Subnet) FromIPv4Mapped() (*Subnet, error) {
+	return s.fromEmbeddedIPv4(ipv4MappedPrefix)
+}
+
+func (s *Subnet) FromIPv4Compatible() (*Subnet, error) {
+	return s.fromEmbeddedIPv4(ipv4CompatiblePrefix)
+}
+
+func (s *Subnet) fromEmbeddedIPv4(prefix *Subnet) (*Subnet, error) {
+	if !prefix.Covers(s) {
+		return nil, fmt.Errorf("subnet is not in %s", prefix.GetCidr())
+	}
+
+	return newSubnetFromInt(s.NetInt.And64(0xffffffff), s.NetOnes-96, false), nil
+}
+
+// ISATAPAddress returns the ISATAP address of ipv4 in the /64 prefix s
+// (RFC 5214). The universal/local bit is set for globally reachable
+// addresses, based on Classify.
+func (s *Subnet) ISATAPAddress(ipv4 net.IP) (net.IP, error) {
+	if !s.isIPv6 || s.NetOnes != 64 {
+		return nil, fmt.Errorf("isatap prefix has to be an ipv6 /64")
+	}
+
+	ipv4, err := toIPv4(ipv4)
+	if err != nil {
+		return nil, err
+	}
+
+	res := s.GetNetwork()
+	copy(res[8:12], []byte{0x00, 0x00, 0x5e, 0xfe})
+	if Classify(ipv4).Global {
+		res[8] |= 0x02
+	}
+	copy(res[12:], ipv4)
+
+	return res, nil
+}
+
+// ExtractISATAP returns the IPv4 address of an ISATAP interface identifier.
+func ExtractISATAP(ip net.IP) (net.IP, error) {
+	ip, err := toIPv6(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip[8]&^0x03 != 0 || ip[9] != 0 || ip[10] != 0x5e || ip[11] != 0xfe {
+		return nil, fmt.Errorf("not an isatap address")
+	}
+
+	return net.IPv4(ip[12], ip[13], ip[14], ip[15]), nil
+}
@@ -0,0 +1,210 @@
+package ipcalc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNAT64(t *testing.T) {
+	// RFC 6052 section 2.4
+	var tests = []struct {
+		prefix, ipv4, want string
+	}{
+		{"2001:db8::/32", "192.0.2.33", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "192.0.2.33", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "192.0.2.33", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "192.0.2.33", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "192.0.2.33", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "192.0.2.33", "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::/96", "192.0.2.33", "64:ff9b::192.0.2.33"},
+		{"64:ff9b::/96", "255.255.255.255", "64:ff9b::ffff:ffff"},
+		{"2001:db8::/33", "192.0.2.33", ""},
+		{"192.0.2.0/24", "192.0.2.33", ""},
+	}
+
+	for _, tt := range tests {
+		prefix := NewSubnet(tt.prefix)
+		got, err := prefix.NAT64Synthesize(net.ParseIP(tt.ipv4))
+		if err != nil {
+			if tt.want != "" {
+				t.Errorf("%s %s: %v", tt.prefix, tt.ipv4, err)
+			}
+			continue
+		}
+
+		if !got.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("%s %s: got %s, want %s", tt.prefix, tt.ipv4, got, tt.want)
+		}
+
+		back, err := prefix.NAT64Extract(got)
+		if err != nil || !back.Equal(net.ParseIP(tt.ipv4)) {
+			t.Errorf("%s %s: extract got %s %v", tt.prefix, tt.ipv4, back, err)
+		}
+	}
+
+	if _, err := NewSubnet("2001:db8::/32").NAT64Extract(net.ParseIP("2001:db9:c000:221::")); err == nil {
+		t.Errorf("extracting from outside of the prefix should fail")
+	}
+
+	if _, err := NewSubnet("2001:db8::/32").NAT64Extract(net.ParseIP("2001:db8:c000:221:100::")); err == nil {
+		t.Errorf("extracting with a non-zero u octet should fail")
+	}
+}
+
+func TestNAT64RandomRoundTrip(t *testing.T) {
+	for _, ones := range []string{"32", "40", "48", "56", "64", "96"} {
+		for i := 0; i < 1000; i++ {
+			prefix := NewSubnet(randIPv6Addr() + "/" + ones)
+			ipv4 := net.ParseIP(randIPv4Addr())
+
+			ip, err := prefix.NAT64Synthesize(ipv4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ip[8] != 0 && prefix.NetOnes < 96 {
+				t.Fatalf("u octet is not zero in %s", ip)
+			}
+
+			// The prefix itself may have a non-zero u octet.
+			if prefix.NetOnes == 64 && prefix.GetNetwork()[8] != 0 {
+				continue
+			}
+
+			back, err := prefix.NAT64Extract(ip)
+			if err != nil || !back.Equal(ipv4) {
+				t.Fatalf("%s %s: got %s %v", prefix.GetCidr(), ipv4, back, err)
+			}
+		}
+	}
+}
+
+func Test6to4(t *testing.T) {
+	s, err := Encode6to4(net.ParseIP("192.0.2.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.GetCidr() != "2002:c000:204::/48" {
+		t.Errorf("got %s, want 2002:c000:204::/48", s.GetCidr())
+	}
+
+	ipv4, err := Decode6to4(net.ParseIP("2002:c000:204:1::1"))
+	if err != nil || !ipv4.Equal(net.ParseIP("192.0.2.4")) {
+		t.Errorf("got %s %v, want 192.0.2.4", ipv4, err)
+	}
+
+	if _, err := Decode6to4(net.ParseIP("2003:c000:204::1")); err == nil {
+		t.Errorf("decoding a non 6to4 address should fail")
+	}
+
+	if _, err := Encode6to4(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("encoding an ipv6 address should fail")
+	}
+}
+
+func TestTeredo(t *testing.T) {
+	// RFC 4380 section 4
+	ip := net.ParseIP("2001:0:4136:e378:8000:63bf:3fff:fdd2")
+
+	teredo, err := DecodeTeredo(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !teredo.Server.Equal(net.ParseIP("65.54.227.120")) {
+		t.Errorf("got server %s, want 65.54.227.120", teredo.Server)
+	}
+	if !teredo.Client.Equal(net.ParseIP("192.0.2.45")) {
+		t.Errorf("got client %s, want 192.0.2.45", teredo.Client)
+	}
+	if teredo.Port != 40000 {
+		t.Errorf("got port %d, want 40000", teredo.Port)
+	}
+	if !teredo.Cone() {
+		t.Errorf("got non cone, want cone")
+	}
+
+	back, err := teredo.Encode()
+	if err != nil || !back.Equal(ip) {
+		t.Errorf("got %s %v, want %s", back, err, ip)
+	}
+
+	if _, err := DecodeTeredo(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("decoding a non teredo address should fail")
+	}
+}
+
+func TestIPv4MappedAndCompatible(t *testing.T) {
+	var tests = []struct {
+		ipv4, mapped, compatible string
+	}{
+		{"192.0.2.0/24", "::ffff:192.0.2.0/120", "::c000:200/120"},
+		{"0.0.0.0/0", "::ffff:0.0.0.0/96", "::/96"},
+		{"10.1.2.3/32", "::ffff:10.1.2.3/128", "::a01:203/128"},
+	}
+
+	for _, tt := range tests {
+		s := NewSubnet(tt.ipv4)
+
+		mapped, err := s.ToIPv4Mapped()
+		if err != nil || mapped.GetCidr() != tt.mapped {
+			t.Errorf("%s: got mapped %v %v, want %s", tt.ipv4, mapped, err, tt.mapped)
+		}
+
+		compatible, err := s.ToIPv4Compatible()
+		if err != nil || compatible.GetCidr() != tt.compatible {
+			t.Errorf("%s: got compatible %v %v, want %s", tt.ipv4, compatible, err, tt.compatible)
+		}
+
+		back, err := NewSubnet(tt.mapped).FromIPv4Mapped()
+		if err != nil || !back.SameSubnet(s) {
+			t.Errorf("%s: got from mapped %v %v", tt.ipv4, back, err)
+		}
+
+		back, err = NewSubnet(tt.compatible).FromIPv4Compatible()
+		if err != nil || !back.SameSubnet(s) {
+			t.Errorf("%s: got from compatible %v %v", tt.ipv4, back, err)
+		}
+	}
+
+	if _, err := NewSubnet("::ffff:0:0/95").FromIPv4Mapped(); err == nil {
+		t.Errorf("converting a larger subnet should fail")
+	}
+
+	if _, err := NewSubnet("2001:db8::/32").ToIPv4Mapped(); err == nil {
+		t.Errorf("converting an ipv6 subnet should fail")
+	}
+}
+
+func TestISATAP(t *testing.T) {
+	prefix := NewSubnet("2001:db8:1:2::/64")
+
+	var tests = []struct {
+		ipv4, want string
+	}{
+		{"192.0.2.143", "2001:db8:1:2:0:5efe:c000:28f"},
+		{"8.8.8.8", "2001:db8:1:2:200:5efe:808:808"},
+	}
+
+	for _, tt := range tests {
+		got, err := prefix.ISATAPAddress(net.ParseIP(tt.ipv4))
+		if err != nil || !got.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("%s: got %s %v, want %s", tt.ipv4, got, err, tt.want)
+			continue
+		}
+
+		back, err := ExtractISATAP(got)
+		if err != nil || !back.Equal(net.ParseIP(tt.ipv4)) {
+			t.Errorf("%s: extract got %s %v", tt.ipv4, back, err)
+		}
+	}
+
+	if _, err := NewSubnet("2001:db8::/48").ISATAPAddress(net.ParseIP("192.0.2.1")); err == nil {
+		t.Errorf("a non /64 prefix should fail")
+	}
+
+	if _, err := ExtractISATAP(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("extracting from a non isatap address should fail")
+	}
+}
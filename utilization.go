@@ -0,0 +1,279 @@
+package ipcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/vrgakos/uint128"
+)
+
+// Utilization describes how much of a prefix is used by the nodes below it.
+type Utilization struct {
+	Prefix *Subnet
+	// Address counts. The 2^128 addresses of ::/0 do not fit into a
+	// uint128, so AllSpace is set for it and a count of 2^128 is kept as 0:
+	// Total, and Allocated or Free when the whole space is allocated or free.
+	// UsedPercent tells them apart, the reports print them right.
+	Total     uint128.Uint128
+	Allocated uint128.Uint128
+	Free      uint128.Uint128
+	AllSpace  bool
+	// UsedPercent is the share of the allocated addresses.
+	UsedPercent float64
+	// LargestFree is the largest free aligned block, nil when nothing is free.
+	LargestFree *Subnet
+	// FreeBlocks counts the free aligned blocks by prefix length.
+	FreeBlocks map[uint8]int
+	// Fragmentation is 0 when the free addresses form a single block and
+	// gets close to 1 as they are scattered into many small ones.
+	Fragmentation float64
+}
+
+// prefixSize returns the number of addresses of a prefix, the 2^128 of ::/0
+// wraps to 0.
+func prefixSize(ones, bits uint8) uint128.Uint128 {
+	if hostBits := bits - ones; hostBits < 128 {
+		return uint128.From64(1).Lsh(uint(hostBits))
+	}
+
+	return uint128.Zero
+}
+
+// prefixSizeFloat returns the number of addresses of a prefix as a float64.
+func prefixSizeFloat(ones, bits uint8) float64 {
+	return math.Exp2(float64(bits - ones))
+}
+
+func uint128Float(u uint128.Uint128) float64 {
+	return float64(u.Hi)*math.Exp2(64) + float64(u.Lo)
+}
+
+// countString formats an address count, all is set for 2^128.
+func countString(n uint128.Uint128, all bool) string {
+	if all {
+		return new(big.Int).Lsh(big.NewInt(1), 128).String()
+	}
+
+	return n.String()
+}
+
+// walkFree calls fn with the free blocks of s in address order: the largest
+// aligned blocks not covered by any node below s.
+func (s *Subnet) walkFree(fn func(*Subnet)) {
+	if s.children[0] == nil && s.children[1] == nil {
+		fn(s.CloneBase())
+		return
+	}
+
+	for bitVal, child := range s.children {
+		if child == nil {
+			half := s.CloneWithOnes(s.NetOnes + 1)
+			if bitVal == 1 {
+				half.SetBit(s.targetBitPosition())
+			}
+			fn(half)
+			continue
+		}
+
+		// Nodes skip the levels without branches, the siblings of the path
+		// to child on these levels are free. The ones before child are the
+		// larger ones first, the ones after child the smaller ones first.
+		after := []*Subnet{}
+		for ones := s.NetOnes + 1; ones < child.NetOnes; ones++ {
+			sibling := child.CloneWithOnes(ones + 1)
+			pos := child.totalNumberOfBits() - ones
+			if child.GetBit(pos) {
+				sibling.ClearBit(pos)
+				fn(sibling)
+			} else {
+				sibling.SetBit(pos)
+				after = append(after, sibling)
+			}
+		}
+
+		if child.isDummy {
+			child.walkFree(fn)
+		}
+
+		for i := len(after) - 1; i >= 0; i-- {
+			fn(after[i])
+		}
+	}
+}
+
+// FreeBlocks returns the free blocks of s in address order: the largest
+// aligned blocks not covered by any node below s. Blocks longer than maxOnes
+// are left out, 0 keeps all of them.
+func (s *Subnet) FreeBlocks(maxOnes uint8) []*Subnet {
+	res := []*Subnet{}
+	s.walkFree(func(block *Subnet) {
+		if maxOnes == 0 || block.NetOnes <= maxOnes {
+			res = append(res, block)
+		}
+	})
+
+	return res
+}
+
+// subtreeOf returns the node of f in the tree of s, or a dummy node of f
+// with the nodes inside f as its children when f is not in the tree.
+func (s *Subnet) subtreeOf(f *Subnet) *Subnet {
+	for node := s; node.Covers(f); {
+		if node.NetOnes == f.NetOnes {
+			return node
+		}
+
+		child := node.children[f.bitValue(node.targetBitPosition())]
+		if child == nil || !child.Covers(f) {
+			view := f.CloneBase()
+			view.isDummy = true
+			if child != nil && f.Covers(child) {
+				view.children[child.bitValue(f.targetBitPosition())] = child
+			}
+			return view
+		}
+		node = child
+	}
+
+	return nil
+}
+
+// allocated returns the number of addresses covered by the nodes below s. It
+// only wraps to 0 when all of ::/0 is allocated.
+func (s *Subnet) allocated() uint128.Uint128 {
+	res := uint128.Zero
+	for _, child := range s.children {
+		if child == nil {
+			continue
+		}
+		if child.isDummy {
+			res = res.AddWrap(child.allocated())
+		} else {
+			res = res.AddWrap(prefixSize(child.NetOnes, child.totalNumberOfBits()))
+		}
+	}
+
+	return res
+}
+
+// Utilization computes the utilization of s by the nodes below it.
+func (s *Subnet) Utilization() *Utilization {
+	bits := s.totalNumberOfBits()
+	u := &Utilization{
+		Prefix:     s.CloneBase(),
+		Total:      prefixSize(s.NetOnes, bits),
+		Allocated:  s.allocated(),
+		AllSpace:   s.NetOnes == 0 && bits == 128,
+		FreeBlocks: map[uint8]int{},
+	}
+	u.Free = u.Total.SubWrap(u.Allocated)
+
+	s.walkFree(func(block *Subnet) {
+		u.FreeBlocks[block.NetOnes]++
+		if u.LargestFree == nil || block.NetOnes < u.LargestFree.NetOnes {
+			u.LargestFree = block
+		}
+	})
+
+	// With nothing free Allocated may have wrapped, otherwise it is less
+	// than the whole prefix.
+	if u.LargestFree == nil {
+		u.UsedPercent = 100
+		return u
+	}
+	total := prefixSizeFloat(s.NetOnes, bits)
+	allocated := uint128Float(u.Allocated)
+	u.UsedPercent = 100 * allocated / total
+	u.Fragmentation = 1 - prefixSizeFloat(u.LargestFree.NetOnes, bits)/(total-allocated)
+
+	return u
+}
+
+// allAllocated and allFree report whether Allocated or Free is 2^128.
+func (u *Utilization) allAllocated() bool {
+	return u.AllSpace && u.LargestFree == nil
+}
+
+func (u *Utilization) allFree() bool {
+	return u.AllSpace && u.LargestFree != nil && u.LargestFree.NetOnes == 0
+}
+
+// freeBlockLengths returns the prefix lengths of the free blocks, the
+// largest blocks first.
+func (u *Utilization) freeBlockLengths() []uint8 {
+	res := []uint8{}
+	for ones := 0; ones <= int(u.Prefix.totalNumberOfBits()); ones++ {
+		if u.FreeBlocks[uint8(ones)] > 0 {
+			res = append(res, uint8(ones))
+		}
+	}
+
+	return res
+}
+
+// String is a text report of the utilization.
+func (u *Utilization) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "prefix:        %s\n", u.Prefix.GetCidr())
+	fmt.Fprintf(b, "total:         %s\n", countString(u.Total, u.AllSpace))
+	fmt.Fprintf(b, "allocated:     %s\n", countString(u.Allocated, u.allAllocated()))
+	fmt.Fprintf(b, "free:          %s\n", countString(u.Free, u.allFree()))
+	fmt.Fprintf(b, "used:          %.2f%%\n", u.UsedPercent)
+
+	largest := "-"
+	if u.LargestFree != nil {
+		largest = u.LargestFree.GetCidr()
+	}
+	fmt.Fprintf(b, "largest free:  %s\n", largest)
+	fmt.Fprintf(b, "fragmentation: %.4f\n", u.Fragmentation)
+
+	if lengths := u.freeBlockLengths(); len(lengths) > 0 {
+		b.WriteString("free blocks:\n")
+		for _, ones := range lengths {
+			fmt.Fprintf(b, "  /%-4d %d\n", ones, u.FreeBlocks[ones])
+		}
+	}
+
+	return b.String()
+}
+
+type utilizationFreeBlocks struct {
+	Length uint8 `json:"length"`
+	Blocks int   `json:"blocks"`
+}
+
+type utilizationJSON struct {
+	Prefix        string                  `json:"prefix"`
+	Total         string                  `json:"total"`
+	Allocated     string                  `json:"allocated"`
+	Free          string                  `json:"free"`
+	UsedPercent   float64                 `json:"used_percent"`
+	LargestFree   string                  `json:"largest_free,omitempty"`
+	FreeBlocks    []utilizationFreeBlocks `json:"free_blocks"`
+	Fragmentation float64                 `json:"fragmentation"`
+}
+
+// MarshalJSON writes the address counts as decimal strings, they do not fit
+// into JSON numbers.
+func (u *Utilization) MarshalJSON() ([]byte, error) {
+	res := utilizationJSON{
+		Prefix:        u.Prefix.GetCidr(),
+		Total:         countString(u.Total, u.AllSpace),
+		Allocated:     countString(u.Allocated, u.allAllocated()),
+		Free:          countString(u.Free, u.allFree()),
+		UsedPercent:   u.UsedPercent,
+		FreeBlocks:    []utilizationFreeBlocks{},
+		Fragmentation: u.Fragmentation,
+	}
+	if u.LargestFree != nil {
+		res.LargestFree = u.LargestFree.GetCidr()
+	}
+	for _, ones := range u.freeBlockLengths() {
+		res.FreeBlocks = append(res.FreeBlocks, utilizationFreeBlocks{Length: ones, Blocks: u.FreeBlocks[ones]})
+	}
+
+	return json.Marshal(res)
+}
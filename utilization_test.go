@@ -0,0 +1,183 @@
+package ipcalc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/vrgakos/uint128"
+)
+
+func TestUtilization(t *testing.T) {
+	table := NewTable()
+	for _, cidr := range []string{"10.0.0.0/8", "10.0.0.0/16", "10.0.1.0/24", "10.1.0.0/24", "10.1.1.0/25", "10.128.0.0/9"} {
+		table.Insert(NewSubnet(cidr))
+	}
+
+	s, _ := table.Find(NewSubnet("10.0.0.0/8"))
+	u := s.Utilization()
+
+	if u.Total.Cmp64(1<<24) != 0 || u.Allocated.Cmp64(1<<16+256+128+1<<23) != 0 || u.Free.Cmp64(1<<23-1<<16-256-128) != 0 || u.AllSpace {
+		t.Errorf("got total %s allocated %s free %s", u.Total, u.Allocated, u.Free)
+	}
+	if u.UsedPercent < 50.39 || u.UsedPercent > 50.40 {
+		t.Errorf("got %v%% used, want 50.39%%", u.UsedPercent)
+	}
+	if got := u.LargestFree.GetCidr(); got != "10.64.0.0/10" {
+		t.Errorf("got largest free %s, want 10.64.0.0/10", got)
+	}
+
+	// 10.1.1.128/25 10.1.2.0/23 10.1.4.0/22 ... 10.1.128.0/17 10.2.0.0/15
+	// 10.4.0.0/14 ... 10.64.0.0/10
+	want := map[uint8]int{25: 1, 24: 0, 23: 1, 22: 1, 21: 1, 20: 1, 19: 1, 18: 1, 17: 1, 15: 1, 14: 1, 13: 1, 12: 1, 11: 1, 10: 1}
+	for ones, n := range want {
+		if got := u.FreeBlocks[ones]; got != n {
+			t.Errorf("/%d: got %d free blocks, want %d", ones, got, n)
+		}
+	}
+	if u.Fragmentation < 0.496 || u.Fragmentation > 0.4961 {
+		t.Errorf("got fragmentation %v, want 0.496", u.Fragmentation)
+	}
+
+	report := u.String()
+	for _, line := range []string{"prefix:        10.0.0.0/8", "used:          50.39%", "largest free:  10.64.0.0/10", "  /25   1"} {
+		if !strings.Contains(report, line) {
+			t.Errorf("got report without %q:\n%s", line, report)
+		}
+	}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res["total"] != "16777216" || res["largest_free"] != "10.64.0.0/10" || len(res["free_blocks"].([]interface{})) != 14 {
+		t.Errorf("got %s", data)
+	}
+}
+
+func TestUtilizationEdges(t *testing.T) {
+	table := NewTable()
+	u := table.ipv6.Utilization()
+	if !u.AllSpace || !u.Total.IsZero() || !u.Free.IsZero() || !u.Allocated.IsZero() || u.UsedPercent != 0 || u.LargestFree.GetCidr() != "::/0" || u.Fragmentation != 0 {
+		t.Errorf("empty ipv6 table: got\n%s", u)
+	}
+	if report := u.String(); !strings.Contains(report, "allocated:     0\n") || !strings.Contains(report, "free:          340282366920938463463374607431768211456\n") {
+		t.Errorf("empty ipv6 table: got report\n%s", report)
+	}
+
+	full := NewSubnet("::/0")
+	full.Insert(NewSubnet("::/1"))
+	full.Insert(NewSubnet("8000::/1"))
+	u = full.Utilization()
+	if !u.AllSpace || !u.Total.IsZero() || !u.Allocated.IsZero() || !u.Free.IsZero() || u.UsedPercent != 100 || u.LargestFree != nil {
+		t.Errorf("full ipv6 space: got\n%s", u)
+	}
+	if report := u.String(); !strings.Contains(report, "allocated:     340282366920938463463374607431768211456\n") || !strings.Contains(report, "free:          0\n") {
+		t.Errorf("full ipv6 space: got report\n%s", report)
+	}
+
+	half := NewSubnet("::/0")
+	half.Insert(NewSubnet("8000::/1"))
+	u = half.Utilization()
+	if !u.Free.Equals(uint128.From64(1).Lsh(127)) || u.UsedPercent != 50 || u.LargestFree.GetCidr() != "::/1" || u.Fragmentation != 0 {
+		t.Errorf("half ipv6 space: got\n%s", u)
+	}
+	if data, _ := json.Marshal(u); !strings.Contains(string(data), `"total":"340282366920938463463374607431768211456","allocated":"170141183460469231731687303715884105728"`) {
+		t.Errorf("got %s, want total 2^128 and allocated 2^127", data)
+	}
+
+	table.Insert(NewSubnet("2001:db8::/32"))
+	table.Insert(NewSubnet("2001:db8::/33"))
+	table.Insert(NewSubnet("2001:db8:8000::/33"))
+	s, _ := table.Find(NewSubnet("2001:db8::/32"))
+	u = s.Utilization()
+	if u.UsedPercent != 100 || !u.Free.IsZero() || u.LargestFree != nil || u.Fragmentation != 0 || u.AllSpace {
+		t.Errorf("full prefix: got\n%s", u)
+	}
+
+	host := NewSubnet("192.0.2.1/32").Utilization()
+	if host.Total.Cmp64(1) != 0 || host.LargestFree.GetCidr() != "192.0.2.1/32" {
+		t.Errorf("host: got\n%s", host)
+	}
+}
+
+func TestFreeBlocks(t *testing.T) {
+	table := NewTable()
+	for _, cidr := range []string{"10.20.0.0/16", "10.20.0.0/24", "10.20.1.0/26", "10.20.64.0/18", "10.20.64.0/20"} {
+		table.Insert(NewSubnet(cidr))
+	}
+
+	var tests = []struct {
+		cidr    string
+		maxOnes uint8
+		want    string
+	}{
+		{"10.20.0.0/16", 0, "10.20.1.64/26 10.20.1.128/25 10.20.2.0/23 10.20.4.0/22 10.20.8.0/21 10.20.16.0/20 10.20.32.0/19 10.20.128.0/17"},
+		{"10.20.0.0/16", 20, "10.20.16.0/20 10.20.32.0/19 10.20.128.0/17"},
+		{"10.20.0.0/17", 0, "10.20.1.64/26 10.20.1.128/25 10.20.2.0/23 10.20.4.0/22 10.20.8.0/21 10.20.16.0/20 10.20.32.0/19"},
+		{"10.20.1.0/24", 0, "10.20.1.64/26 10.20.1.128/25"},
+		{"10.20.64.0/20", 0, "10.20.64.0/20"},
+		{"10.21.0.0/16", 0, "10.21.0.0/16"},
+		{"2001:db8::/32", 0, "2001:db8::/32"},
+	}
+
+	for _, tt := range tests {
+		blocks := []string{}
+		for _, s := range table.FreeBlocks(NewSubnet(tt.cidr), tt.maxOnes) {
+			blocks = append(blocks, s.GetCidr())
+		}
+		if got := strings.Join(blocks, " "); got != tt.want {
+			t.Errorf("%s /%d: got %s, want %s", tt.cidr, tt.maxOnes, got, tt.want)
+		}
+	}
+}
+
+func TestFreeBlocksRandom(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		pool := NewSubnet("10.20.0.0/16")
+		for j := 0; j < 20; j++ {
+			pool.Insert(NewSubnet(fmt.Sprintf("10.20.%d.%d/%d", rand.Intn(256), rand.Intn(256), 17+rand.Intn(16))))
+		}
+		allocated := []*Subnet{}
+		pool.Walk(func(s *Subnet) bool {
+			if s != pool {
+				allocated = append(allocated, s)
+			}
+			return true
+		})
+
+		free := uint128.Zero
+		blocks := pool.FreeBlocks(0)
+		for k, b := range blocks {
+			free = free.Add(prefixSize(b.NetOnes, 32))
+			if k > 0 && !lessSubnet(blocks[k-1], b) {
+				t.Fatalf("got %s before %s, want address order", blocks[k-1].GetCidr(), b.GetCidr())
+			}
+
+			// The block is free, and it would not be if it was any larger.
+			buddyFree := true
+			parent := b.CloneWithOnes(b.NetOnes - 1)
+			for _, a := range allocated {
+				if a.Covers(b) || b.Covers(a) {
+					t.Fatalf("got free block %s overlapping %s", b.GetCidr(), a.GetCidr())
+				}
+				if parent.Covers(a) || a.Covers(parent) {
+					buddyFree = false
+				}
+			}
+			if buddyFree && b.NetOnes > pool.NetOnes {
+				t.Fatalf("got free block %s, want its free parent", b.GetCidr())
+			}
+		}
+
+		if !free.Equals(pool.Utilization().Free) {
+			t.Fatalf("got %s free addresses, want %s", free, pool.Utilization().Free)
+		}
+	}
+}